@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const DevViewerHeader = "X-Viewer-Id"
+
+type Config struct {
+	HS256Secret    []byte
+	RS256PublicKey *rsa.PublicKey
+	// DevMode trusts the X-Viewer-Id header as the viewer when no token is
+	// sent. It must only be enabled for local testing.
+	DevMode bool
+}
+
+func LoadConfig(secretFile, publicKeyFile string, devMode bool) (Config, error) {
+	cfg := Config{DevMode: devMode}
+
+	secret, err := readKey(secretFile, "JWT_SECRET")
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read HS256 secret: %w", err)
+	}
+	if len(secret) > 0 {
+		cfg.HS256Secret = secret
+	}
+
+	publicKey, err := readKey(publicKeyFile, "JWT_PUBLIC_KEY")
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read RS256 public key: %w", err)
+	}
+	if len(publicKey) > 0 {
+		cfg.RS256PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicKey)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse RS256 public key: %w", err)
+		}
+	}
+
+	if cfg.HS256Secret == nil && cfg.RS256PublicKey == nil && !cfg.DevMode {
+		return Config{}, errors.New("no JWT key configured: set JWT_SECRET or JWT_PUBLIC_KEY, pass a key file, or enable dev mode")
+	}
+
+	return cfg, nil
+}
+
+func readKey(path, envVar string) ([]byte, error) {
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	return []byte(os.Getenv(envVar)), nil
+}
+
+func Middleware(cfg Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+
+		if header == "" {
+			if id := r.Header.Get(DevViewerHeader); cfg.DevMode && id != "" {
+				r = r.WithContext(WithViewer(r.Context(), &Viewer{ID: id}))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found {
+			unauthorized(w, "Authorization header must use the Bearer scheme")
+			return
+		}
+
+		viewer, err := cfg.parse(token)
+		if err != nil {
+			unauthorized(w, "Invalid token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithViewer(r.Context(), viewer)))
+	})
+}
+
+func (cfg Config) parse(tokenString string) (*Viewer, error) {
+	token, err := jwt.Parse(tokenString, cfg.key,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := token.Claims.GetSubject()
+	if err != nil {
+		return nil, err
+	}
+	if subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return &Viewer{ID: subject}, nil
+}
+
+func (cfg Config) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		if cfg.HS256Secret != nil {
+			return cfg.HS256Secret, nil
+		}
+	case jwt.SigningMethodRS256.Alg():
+		if cfg.RS256PublicKey != nil {
+			return cfg.RS256PublicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("no key configured for %s tokens", token.Method.Alg())
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="ozontz"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("test-secret")
+
+func signHS256(t *testing.T, secret []byte, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	require.NoError(t, err)
+	return token
+}
+
+func validClaims(subject string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": subject,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// serve runs a request through the middleware and reports the viewer the
+// wrapped handler saw, if it was reached at all.
+func serve(cfg Config, headers map[string]string) (*httptest.ResponseRecorder, *Viewer, bool) {
+	var (
+		viewer  *Viewer
+		reached bool
+	)
+	handler := Middleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		viewer, _ = ViewerFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	return rr, viewer, reached
+}
+
+func TestMiddlewareHS256(t *testing.T) {
+	cfg := Config{HS256Secret: testSecret}
+
+	t.Run("Valid token", func(t *testing.T) {
+		token := signHS256(t, testSecret, validClaims("user-1"))
+
+		rr, viewer, reached := serve(cfg, map[string]string{"Authorization": "Bearer " + token})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.True(t, reached)
+		assert.Equal(t, &Viewer{ID: "user-1"}, viewer)
+	})
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		token := signHS256(t, []byte("other-secret"), validClaims("user-1"))
+
+		rr, _, reached := serve(cfg, map[string]string{"Authorization": "Bearer " + token})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+		assert.False(t, reached)
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		token := signHS256(t, testSecret, jwt.MapClaims{
+			"sub": "user-1",
+			"exp": time.Now().Add(-time.Minute).Unix(),
+		})
+
+		rr, _, reached := serve(cfg, map[string]string{"Authorization": "Bearer " + token})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.False(t, reached)
+	})
+
+	t.Run("Missing expiry", func(t *testing.T) {
+		token := signHS256(t, testSecret, jwt.MapClaims{"sub": "user-1"})
+
+		rr, _, reached := serve(cfg, map[string]string{"Authorization": "Bearer " + token})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.False(t, reached)
+	})
+
+	t.Run("Missing subject", func(t *testing.T) {
+		token := signHS256(t, testSecret, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+
+		rr, _, reached := serve(cfg, map[string]string{"Authorization": "Bearer " + token})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.False(t, reached)
+	})
+
+	t.Run("Wrong scheme", func(t *testing.T) {
+		rr, _, reached := serve(cfg, map[string]string{"Authorization": "Basic dXNlcjpwYXNz"})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.False(t, reached)
+	})
+}
+
+func TestMiddlewareRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	cfg := Config{RS256PublicKey: &key.PublicKey}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims("user-2")).SignedString(key)
+	require.NoError(t, err)
+
+	rr, viewer, reached := serve(cfg, map[string]string{"Authorization": "Bearer " + token})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, reached)
+	assert.Equal(t, &Viewer{ID: "user-2"}, viewer)
+
+	// An HS256 token must not be accepted when only an RS256 key is configured.
+	hsToken := signHS256(t, testSecret, validClaims("user-2"))
+	rr, _, reached = serve(cfg, map[string]string{"Authorization": "Bearer " + hsToken})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.False(t, reached)
+}
+
+func TestMiddlewareAnonymous(t *testing.T) {
+	rr, viewer, reached := serve(Config{HS256Secret: testSecret}, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, reached)
+	assert.Nil(t, viewer)
+}
+
+func TestMiddlewareDevMode(t *testing.T) {
+	headers := map[string]string{DevViewerHeader: "user-dev"}
+
+	_, viewer, reached := serve(Config{DevMode: true}, headers)
+	assert.True(t, reached)
+	assert.Equal(t, &Viewer{ID: "user-dev"}, viewer)
+
+	_, viewer, reached = serve(Config{HS256Secret: testSecret}, headers)
+	assert.True(t, reached)
+	assert.Nil(t, viewer)
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_PUBLIC_KEY", "")
+
+	t.Run("No key", func(t *testing.T) {
+		_, err := LoadConfig("", "", false)
+		assert.Error(t, err)
+
+		cfg, err := LoadConfig("", "", true)
+		assert.NoError(t, err)
+		assert.True(t, cfg.DevMode)
+	})
+
+	t.Run("Secret from env", func(t *testing.T) {
+		t.Setenv("JWT_SECRET", "env-secret")
+
+		cfg, err := LoadConfig("", "", false)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("env-secret"), cfg.HS256Secret)
+	})
+
+	t.Run("Keys from files", func(t *testing.T) {
+		dir := t.TempDir()
+
+		secretFile := filepath.Join(dir, "secret")
+		require.NoError(t, os.WriteFile(secretFile, []byte("file-secret"), 0o600))
+
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		require.NoError(t, err)
+		publicKeyFile := filepath.Join(dir, "public.pem")
+		require.NoError(t, os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+		cfg, err := LoadConfig(secretFile, publicKeyFile, false)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("file-secret"), cfg.HS256Secret)
+		assert.True(t, key.PublicKey.Equal(cfg.RS256PublicKey))
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(t.TempDir(), "missing"), "", false)
+		assert.Error(t, err)
+	})
+}
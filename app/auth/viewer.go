@@ -0,0 +1,21 @@
+package auth
+
+import "context"
+
+type Viewer struct {
+	ID string `json:"id"`
+}
+
+type viewerKey struct{}
+
+func WithViewer(ctx context.Context, viewer *Viewer) context.Context {
+	return context.WithValue(ctx, viewerKey{}, viewer)
+}
+
+func ViewerFromContext(ctx context.Context) (*Viewer, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	viewer, ok := ctx.Value(viewerKey{}).(*Viewer)
+	return viewer, ok && viewer != nil
+}
@@ -0,0 +1,367 @@
+// Package config assembles the configuration of the server from defaults, a
+// YAML file, env variables and command line flags, each overriding the
+// previous ones.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"ozontz/app/graph"
+	"ozontz/app/logging"
+	"ozontz/app/storage"
+	"ozontz/app/tracing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the configuration file when -config is not passed.
+const FileEnv = "OZONTZ_CONFIG"
+
+// envPrefix starts the env variable of every flag, for example
+// OZONTZ_MAX_QUERY_DEPTH for -max-query-depth.
+const envPrefix = "OZONTZ_"
+
+// legacyEnv maps the env variables the server used to read the database
+// parameters from to their flags. The prefixed variables take precedence.
+var legacyEnv = map[string]string{
+	"DB_HOST":     "db-host",
+	"DB_PORT":     "db-port",
+	"DB_USER":     "db-user",
+	"DB_PASSWORD": "db-password",
+	"DB_NAME":     "db-name",
+}
+
+type Config struct {
+	Server           ServerConfig           `yaml:"server"`
+	Storage          StorageConfig          `yaml:"storage"`
+	Database         storage.PostgresConfig `yaml:"database"`
+	Limits           storage.Limits         `yaml:"limits"`
+	Query            graph.QueryLimits      `yaml:"query"`
+	Batch            graph.BatchConfig      `yaml:"batch"`
+	PersistedQueries PersistedQueriesConfig `yaml:"persisted_queries"`
+	Auth             AuthConfig             `yaml:"auth"`
+	Tracing          tracing.Config         `yaml:"tracing"`
+	Logging          logging.Config         `yaml:"logging"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set.
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+
+	RequestTimeout    time.Duration `yaml:"request_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay"`
+}
+
+type StorageConfig struct {
+	Type       string            `yaml:"type"`
+	SQLitePath string            `yaml:"sqlite_path"`
+	IDFormat   string            `yaml:"id_format"`
+	WAL        storage.WALConfig `yaml:"wal"`
+}
+
+type PersistedQueriesConfig struct {
+	Mode      string `yaml:"mode"`
+	Store     string `yaml:"store"`
+	CacheSize int    `yaml:"cache_size"`
+	Manifest  string `yaml:"manifest"`
+}
+
+type AuthConfig struct {
+	JWTSecretFile    string `yaml:"jwt_secret_file"`
+	JWTPublicKeyFile string `yaml:"jwt_public_key_file"`
+	Dev              bool   `yaml:"dev"`
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			RequestTimeout:    10 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   5 * time.Second,
+		},
+		Storage: StorageConfig{
+			Type:       "inmemory",
+			SQLitePath: "ozontz.db",
+			IDFormat:   "ulid",
+			WAL: storage.WALConfig{
+				Fsync:         storage.FsyncInterval,
+				FsyncInterval: time.Second,
+				CompactAfter:  10000,
+			},
+		},
+		Database: storage.DefaultPostgresConfig,
+		Limits:   storage.DefaultLimits,
+		Query:    graph.DefaultQueryLimits,
+		Batch:    graph.DefaultBatchConfig,
+		PersistedQueries: PersistedQueriesConfig{
+			Mode:      "apq",
+			Store:     "memory",
+			CacheSize: 1000,
+		},
+		Tracing: tracing.Config{
+			Exporter:    tracing.ExporterNone,
+			File:        "traces.json",
+			SampleRatio: 1,
+			ServiceName: "ozontz",
+		},
+		Logging: logging.Config{
+			Level:  "info",
+			Format: logging.FormatJSON,
+		},
+	}
+}
+
+// Load builds the configuration of the command name. The file is taken from
+// the -config flag or the OZONTZ_CONFIG env variable. It returns
+// flag.ErrHelp if args ask for usage.
+func Load(name string, args []string) (*Config, error) {
+	cfg := Default()
+
+	path := configPath(args)
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.String("config", path, "YAML configuration file. Falls back to the "+FileEnv+" env variable")
+	cfg.bind(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of %s:\n", name)
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nEvery flag can also be set with an env variable, e.g. %sMAX_QUERY_DEPTH for -max-query-depth.\n", envPrefix)
+	}
+
+	if err := applyEnv(flags); err != nil {
+		return nil, err
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	return cfg, nil
+}
+
+// configPath finds the -config flag in args before they are parsed, as the
+// file sets the defaults of the other flags.
+func configPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv(FileEnv)
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv sets the flags that have an env variable. Errors name the
+// variable, not the flag.
+func applyEnv(flags *flag.FlagSet) error {
+	for env, name := range legacyEnv {
+		if value, ok := os.LookupEnv(env); ok {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("invalid %s=%q: %w", env, value, err)
+			}
+		}
+	}
+
+	var errs []error
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		env := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(env); ok {
+			if err := flags.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s=%q: %w", env, value, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// bind defines a flag for every setting, defaulting to its current value.
+func (c *Config) bind(flags *flag.FlagSet) {
+	flags.StringVar(&c.Server.Addr, "addr", c.Server.Addr, "Address the server listens on")
+	flags.StringVar(&c.Server.TLSCertFile, "tls-cert-file", c.Server.TLSCertFile, "PEM certificate, serves HTTPS together with -tls-key-file")
+	flags.StringVar(&c.Server.TLSKeyFile, "tls-key-file", c.Server.TLSKeyFile, "PEM private key of -tls-cert-file")
+	flags.DurationVar(&c.Server.RequestTimeout, "request-timeout", c.Server.RequestTimeout, "Deadline for a single /query request, 0 disables it")
+	flags.DurationVar(&c.Server.ReadHeaderTimeout, "read-header-timeout", c.Server.ReadHeaderTimeout, "Time allowed to read request headers, 0 disables it")
+	flags.DurationVar(&c.Server.ShutdownTimeout, "shutdown-timeout", c.Server.ShutdownTimeout, "Time in-flight requests get to finish on shutdown")
+	flags.DurationVar(&c.Server.ShutdownDelay, "shutdown-delay", c.Server.ShutdownDelay, "How long /readyz reports the server unavailable before it stops accepting connections on shutdown")
+
+	flags.StringVar(&c.Storage.Type, "storage", c.Storage.Type, "Select storage type: 'inmemory', 'postgres' or 'sqlite'")
+	flags.StringVar(&c.Storage.SQLitePath, "sqlite-path", c.Storage.SQLitePath, "Database file of the 'sqlite' storage")
+	flags.StringVar(&c.Storage.IDFormat, "id-format", c.Storage.IDFormat, "Format of generated post and comment IDs: 'ulid' or 'uuidv7'")
+	flags.StringVar(&c.Storage.WAL.Dir, "wal-dir", c.Storage.WAL.Dir, "Directory for the write-ahead log and snapshots of the 'inmemory' storage. Empty keeps data in memory only")
+	flags.StringVar((*string)(&c.Storage.WAL.Fsync), "wal-fsync", string(c.Storage.WAL.Fsync), "When the write-ahead log is synced to disk: 'always', 'interval' or 'never'")
+	flags.DurationVar(&c.Storage.WAL.FsyncInterval, "wal-fsync-interval", c.Storage.WAL.FsyncInterval, "How often the write-ahead log is synced with -wal-fsync=interval")
+	flags.IntVar(&c.Storage.WAL.CompactAfter, "wal-compact-after", c.Storage.WAL.CompactAfter, "Number of logged writes after which a snapshot is taken and the log truncated, 0 disables compaction")
+
+	flags.StringVar(&c.Database.DSN, "db-dsn", c.Database.DSN, "PostgreSQL connection string, replaces the other -db-* connection flags")
+	flags.StringVar(&c.Database.Host, "db-host", c.Database.Host, "PostgreSQL host")
+	flags.IntVar(&c.Database.Port, "db-port", c.Database.Port, "PostgreSQL port")
+	flags.StringVar(&c.Database.User, "db-user", c.Database.User, "PostgreSQL user")
+	flags.StringVar(&c.Database.Password, "db-password", c.Database.Password, "PostgreSQL password. Prefer the DB_PASSWORD env variable, flags are visible to other users")
+	flags.StringVar(&c.Database.Name, "db-name", c.Database.Name, "PostgreSQL database name")
+	flags.StringVar(&c.Database.SSLMode, "db-sslmode", c.Database.SSLMode, "PostgreSQL sslmode: 'disable', 'require', 'verify-ca' or 'verify-full'")
+	flags.IntVar(&c.Database.MaxOpenConns, "db-max-open-conns", c.Database.MaxOpenConns, "Maximum number of open database connections, 0 leaves it unbounded")
+	flags.IntVar(&c.Database.MaxIdleConns, "db-max-idle-conns", c.Database.MaxIdleConns, "Maximum number of idle database connections")
+	flags.DurationVar(&c.Database.ConnMaxLifetime, "db-conn-max-lifetime", c.Database.ConnMaxLifetime, "Time after which a database connection is replaced, 0 keeps connections")
+
+	flags.IntVar(&c.Limits.PostsPageSize, "posts-page-size", c.Limits.PostsPageSize, "Number of posts returned when a query asks for neither first nor last")
+	flags.IntVar(&c.Limits.CommentsPageSize, "comments-page-size", c.Limits.CommentsPageSize, "Number of comments and replies returned when a query asks for neither first nor last")
+	flags.IntVar(&c.Limits.MaxTextLength, "max-text-length", c.Limits.MaxTextLength, "Longest accepted comment text, in characters")
+
+	flags.IntVar(&c.Query.MaxDepth, "max-query-depth", c.Query.MaxDepth, "Maximum nesting depth of fields in a GraphQL query, 0 disables the check")
+	flags.IntVar(&c.Query.MaxAliases, "max-query-aliases", c.Query.MaxAliases, "Maximum number of aliased fields in a GraphQL query, 0 disables the check")
+	flags.IntVar(&c.Query.MaxCost, "max-query-cost", c.Query.MaxCost, "Maximum estimated cost of a GraphQL query, 0 disables the check")
+	flags.IntVar(&c.Batch.MaxSize, "max-batch-size", c.Batch.MaxSize, "Maximum number of operations in a batched /query request, 0 disables batching")
+	flags.IntVar(&c.Batch.Concurrency, "batch-concurrency", c.Batch.Concurrency, "Number of operations of a batch executed concurrently")
+
+	flags.StringVar(&c.PersistedQueries.Mode, "persisted-queries", c.PersistedQueries.Mode, "Persisted queries mode: 'off', 'apq' (clients register queries by hash) or 'allowlist' (only preloaded queries are executed)")
+	flags.StringVar(&c.PersistedQueries.Store, "persisted-query-store", c.PersistedQueries.Store, "Where persisted queries are kept: 'memory' or 'postgres' (requires -storage=postgres)")
+	flags.IntVar(&c.PersistedQueries.CacheSize, "persisted-query-cache-size", c.PersistedQueries.CacheSize, "Number of queries kept by the persisted query store in 'apq' mode, 0 keeps every query")
+	flags.StringVar(&c.PersistedQueries.Manifest, "persisted-query-manifest", c.PersistedQueries.Manifest, "Apollo persisted query manifest preloaded into the persisted query store at startup")
+
+	flags.StringVar(&c.Auth.JWTSecretFile, "jwt-secret-file", c.Auth.JWTSecretFile, "Path to the HS256 JWT secret. Falls back to the JWT_SECRET env variable")
+	flags.StringVar(&c.Auth.JWTPublicKeyFile, "jwt-public-key-file", c.Auth.JWTPublicKeyFile, "Path to the PEM encoded RS256 JWT public key. Falls back to the JWT_PUBLIC_KEY env variable")
+	flags.BoolVar(&c.Auth.Dev, "auth-dev", c.Auth.Dev, "Trust the X-Viewer-Id header when no token is sent. For local testing only")
+
+	flags.StringVar(&c.Tracing.Exporter, "trace-exporter", c.Tracing.Exporter, "Where traces are sent: 'none', 'otlp', 'stdout' or 'file'")
+	flags.StringVar(&c.Tracing.Endpoint, "trace-endpoint", c.Tracing.Endpoint, "URL of the OTLP/HTTP collector of the 'otlp' exporter. Falls back to the OTEL_EXPORTER_OTLP_ENDPOINT env variable")
+	flags.StringVar(&c.Tracing.File, "trace-file", c.Tracing.File, "File the 'file' exporter appends spans to")
+	flags.Float64Var(&c.Tracing.SampleRatio, "trace-sample-ratio", c.Tracing.SampleRatio, "Share of requests without a sampled traceparent header that are traced")
+
+	flags.StringVar(&c.Logging.Level, "log-level", c.Logging.Level, "Minimum level of logged records: 'debug', 'info', 'warn' or 'error'")
+	flags.StringVar(&c.Logging.Format, "log-format", c.Logging.Format, "Format of log records: 'json' or 'text'")
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(section string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", section, err))
+		}
+	}
+
+	if c.Server.Addr == "" {
+		check("server", errors.New("addr is required"))
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		check("server", errors.New("tls_cert_file and tls_key_file must be set together"))
+	} else if c.Server.TLSCertFile != "" {
+		_, err := tls.LoadX509KeyPair(c.Server.TLSCertFile, c.Server.TLSKeyFile)
+		check("server", err)
+	}
+	if c.Server.RequestTimeout < 0 || c.Server.ReadHeaderTimeout < 0 || c.Server.ShutdownTimeout < 0 || c.Server.ShutdownDelay < 0 {
+		check("server", errors.New("timeouts must not be negative"))
+	}
+
+	switch c.Storage.Type {
+	case "inmemory":
+		if c.Storage.WAL.Dir != "" {
+			policy, err := storage.ParseFsyncPolicy(string(c.Storage.WAL.Fsync))
+			check("storage", err)
+			if policy == storage.FsyncInterval && c.Storage.WAL.FsyncInterval <= 0 {
+				check("storage", errors.New("wal fsync_interval must be positive with the 'interval' fsync policy"))
+			}
+		}
+	case "postgres":
+		_, err := c.Database.ConnString()
+		check("database", err)
+		if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 {
+			check("database", errors.New("pool settings must not be negative"))
+		}
+	case "sqlite":
+		if c.Storage.SQLitePath == "" {
+			check("storage", errors.New("sqlite_path is required"))
+		}
+	default:
+		check("storage", fmt.Errorf("unknown type %q, expected 'inmemory', 'postgres' or 'sqlite'", c.Storage.Type))
+	}
+	_, err := storage.NewIDGenerator(c.Storage.IDFormat)
+	check("storage", err)
+	check("limits", c.Limits.Validate())
+
+	if c.Query.MaxDepth < 0 || c.Query.MaxAliases < 0 || c.Query.MaxCost < 0 {
+		check("query", errors.New("limits must not be negative"))
+	}
+	if c.Batch.MaxSize < 0 || c.Batch.Concurrency < 1 {
+		check("batch", errors.New("max_size must not be negative and concurrency must be positive"))
+	}
+
+	switch c.PersistedQueries.Mode {
+	case "off":
+	case "apq", "allowlist":
+		switch c.PersistedQueries.Store {
+		case "memory":
+		case "postgres":
+			if c.Storage.Type != "postgres" {
+				check("persisted_queries", errors.New("the 'postgres' store requires the 'postgres' storage"))
+			}
+		default:
+			check("persisted_queries", fmt.Errorf("unknown store %q, expected 'memory' or 'postgres'", c.PersistedQueries.Store))
+		}
+	default:
+		check("persisted_queries", fmt.Errorf("unknown mode %q, expected 'off', 'apq' or 'allowlist'", c.PersistedQueries.Mode))
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		if c.Tracing.File == "" {
+			check("tracing", errors.New("file is required by the 'file' exporter"))
+		}
+	default:
+		check("tracing", fmt.Errorf("unknown exporter %q, expected 'none', 'otlp', 'stdout' or 'file'", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		check("tracing", errors.New("sample_ratio must be between 0 and 1"))
+	}
+
+	_, err = logging.New(io.Discard, c.Logging)
+	check("logging", err)
+
+	return errors.Join(errs...)
+}
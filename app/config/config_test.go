@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ozontz/app/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv(FileEnv, "")
+
+	cfg, err := Load("test", nil)
+	require.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+	assert.Equal(t, storage.DefaultLimits, cfg.Limits)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  addr: ":9000"
+  request_timeout: 3s
+database:
+  host: file-host
+  port: 6432
+  name: ozontz
+limits:
+  posts_page_size: 20
+  comments_page_size: 8
+`)
+	t.Setenv("DB_HOST", "legacy-host")
+	t.Setenv("DB_USER", "legacy-user")
+	t.Setenv("OZONTZ_DB_USER", "env-user")
+	t.Setenv("OZONTZ_POSTS_PAGE_SIZE", "30")
+	t.Setenv("OZONTZ_ADDR", ":9001")
+
+	cfg, err := Load("test", []string{"-config", path, "-addr", ":9002"})
+	require.NoError(t, err)
+
+	assert.Equal(t, ":9002", cfg.Server.Addr, "flags override env")
+	assert.Equal(t, 3*time.Second, cfg.Server.RequestTimeout, "file overrides defaults")
+	assert.Equal(t, "legacy-host", cfg.Database.Host, "env overrides the file")
+	assert.Equal(t, "env-user", cfg.Database.User, "prefixed env overrides legacy env")
+	assert.Equal(t, 6432, cfg.Database.Port)
+	assert.Equal(t, 30, cfg.Limits.PostsPageSize)
+	assert.Equal(t, 8, cfg.Limits.CommentsPageSize)
+	assert.Equal(t, storage.DefaultLimits.MaxTextLength, cfg.Limits.MaxTextLength)
+}
+
+func TestLoadFileFromEnv(t *testing.T) {
+	t.Setenv(FileEnv, writeFile(t, "storage:\n  type: sqlite\n"))
+
+	cfg, err := Load("test", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "sqlite", cfg.Storage.Type)
+
+	cfg, err = Load("test", []string{"--config=" + writeFile(t, "storage:\n  type: postgres\n")})
+	require.NoError(t, err)
+	assert.Equal(t, "postgres", cfg.Storage.Type, "-config overrides the env variable")
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv(FileEnv, "")
+
+	_, err := Load("test", []string{"-config", writeFile(t, "server:\n  adr: \":8080\"\n")})
+	assert.ErrorContains(t, err, "field adr not found")
+
+	_, err = Load("test", []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.ErrorContains(t, err, "failed to read config file")
+
+	_, err = Load("test", []string{"extra"})
+	assert.ErrorContains(t, err, "unexpected arguments: extra")
+
+	t.Setenv("OZONTZ_MAX_QUERY_DEPTH", "deep")
+	_, err = Load("test", nil)
+	assert.ErrorContains(t, err, `invalid OZONTZ_MAX_QUERY_DEPTH="deep"`)
+}
+
+func TestLoadHelp(t *testing.T) {
+	t.Setenv(FileEnv, "")
+
+	_, err := Load("test", []string{"-h"})
+	assert.True(t, errors.Is(err, flag.ErrHelp))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Default().Validate())
+
+	cfg := Default()
+	cfg.Server.TLSCertFile = "cert.pem"
+	cfg.Storage.Type = "postgres"
+	cfg.Limits.CommentsPageSize = 0
+	cfg.Tracing.SampleRatio = 2
+	cfg.Logging.Format = "xml"
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "server: tls_cert_file and tls_key_file must be set together")
+	assert.ErrorContains(t, err, "database: database host, user, name not set")
+	assert.ErrorContains(t, err, "limits: ")
+	assert.ErrorContains(t, err, "tracing: sample_ratio must be between 0 and 1")
+	assert.ErrorContains(t, err, `logging: invalid log format "xml"`)
+
+	cfg = Default()
+	cfg.Storage.WAL.Dir = t.TempDir()
+	cfg.Storage.WAL.FsyncInterval = 0
+	assert.ErrorContains(t, cfg.Validate(), "storage: wal fsync_interval must be positive")
+	cfg.Storage.WAL.Fsync = storage.FsyncNever
+	assert.NoError(t, cfg.Validate())
+
+	cfg = Default()
+	cfg.PersistedQueries.Store = "postgres"
+	assert.ErrorContains(t, cfg.Validate(), "the 'postgres' store requires the 'postgres' storage")
+}
@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+)
+
+// BatchConfig bounds batched requests, JSON arrays of operations sent in one
+// POST. Operations of a batch are independent: they run concurrently and
+// their results are returned in the order of the request.
+type BatchConfig struct {
+	// MaxSize is the largest number of operations in a batch, 0 disables
+	// batching.
+	MaxSize int `yaml:"max_size"`
+	// Concurrency is the number of operations of a batch executed at once.
+	Concurrency int `yaml:"concurrency"`
+}
+
+var DefaultBatchConfig = BatchConfig{
+	MaxSize:     10,
+	Concurrency: 4,
+}
+
+var batchConfig = DefaultBatchConfig
+
+// SetBatchConfig replaces the batch limits. It is meant to be called once at
+// startup.
+func SetBatchConfig(c BatchConfig) {
+	batchConfig = c
+}
+
+func readBatch(body []byte) ([]graphQLRequest, *httpError) {
+	if batchConfig.MaxSize <= 0 {
+		return nil, &httpError{http.StatusBadRequest, "Batched requests are not supported"}
+	}
+
+	var requests []graphQLRequest
+	if err := json.Unmarshal(body, &requests); err != nil {
+		return nil, &httpError{http.StatusBadRequest, "Invalid JSON payload"}
+	}
+	if len(requests) == 0 {
+		return nil, &httpError{http.StatusBadRequest, "Batch is empty"}
+	}
+	if len(requests) > batchConfig.MaxSize {
+		return nil, &httpError{http.StatusBadRequest, fmt.Sprintf("Batch of %d operations exceeds the limit of %d", len(requests), batchConfig.MaxSize)}
+	}
+
+	for _, params := range requests {
+		if err := checkOperation(params); err != nil {
+			return nil, err
+		}
+	}
+	return requests, nil
+}
+
+func executeBatch(ctx context.Context, schema *graphql.Schema, mediaType string, requests []graphQLRequest) []graphQLResponse {
+	responses := make([]graphQLResponse, len(requests))
+	slots := make(chan struct{}, max(batchConfig.Concurrency, 1))
+
+	var wg sync.WaitGroup
+	for i, params := range requests {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			_, responses[i] = execute(ctx, schema, http.MethodPost, mediaType, params)
+		}()
+	}
+	wg.Wait()
+
+	return responses
+}
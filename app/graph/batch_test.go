@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withBatchConfig(t *testing.T, c BatchConfig) {
+	SetBatchConfig(c)
+	t.Cleanup(func() { SetBatchConfig(DefaultBatchConfig) })
+}
+
+func postBatch(t *testing.T, schema *graphql.Schema, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(body))
+	req.Header.Set("Accept", mediaTypeGraphQLResponse)
+	w := httptest.NewRecorder()
+	GraphQLHandler(schema)(w, req)
+	return w
+}
+
+func TestBatchedRequests(t *testing.T) {
+	w := postBatch(t, &mockSchema, ` [
+		{"query": "{ hello }"},
+		{"query": "{ missing }"},
+		{"query": "{ hello"},
+		{"query": "mutation Touch { touch }", "operationName": "Touch"}
+	]`)
+	require.Equal(t, http.StatusOK, w.Code, "a batch is answered with 200 whatever its operations return")
+
+	var responses []testResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &responses))
+	require.Len(t, responses, 4)
+
+	assert.Equal(t, "world", responses[0].Data["hello"])
+	assert.Empty(t, responses[0].Errors)
+
+	require.Len(t, responses[1].Errors, 1)
+	assert.Equal(t, codeNotFound, responses[1].Errors[0].Extensions["code"])
+
+	assert.Nil(t, responses[2].Data)
+	require.Len(t, responses[2].Errors, 1)
+	assert.Equal(t, codeValidation, responses[2].Errors[0].Extensions["code"])
+
+	assert.Equal(t, true, responses[3].Data["touch"])
+}
+
+func TestBatchLimits(t *testing.T) {
+	withBatchConfig(t, BatchConfig{MaxSize: 2, Concurrency: 1})
+
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"Too many operations", `[{"query": "{ hello }"}, {"query": "{ hello }"}, {"query": "{ hello }"}]`, "Batch of 3 operations exceeds the limit of 2"},
+		{"Empty batch", `[]`, "Batch is empty"},
+		{"Operation without query", `[{"query": "{ hello }"}, {}]`, "Query is required"},
+		{"Invalid operation", `[{"query": 1}]`, "Invalid JSON payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postBatch(t, &mockSchema, tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			resp := decodeResponse(t, w)
+			require.Len(t, resp.Errors, 1)
+			assert.Equal(t, tt.message, resp.Errors[0].Message)
+		})
+	}
+
+	t.Run("Batching disabled", func(t *testing.T) {
+		withBatchConfig(t, BatchConfig{})
+		w := postBatch(t, &mockSchema, `[{"query": "{ hello }"}]`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Batched requests are not supported")
+	})
+}
+
+func TestBatchConcurrencyIsBounded(t *testing.T) {
+	withBatchConfig(t, BatchConfig{MaxSize: 10, Concurrency: 2})
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "RootQuery",
+			Fields: graphql.Fields{
+				"slow": &graphql.Field{
+					Type: graphql.Boolean,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						mu.Lock()
+						running++
+						peak = max(peak, running)
+						mu.Unlock()
+
+						time.Sleep(20 * time.Millisecond)
+
+						mu.Lock()
+						running--
+						mu.Unlock()
+						return true, nil
+					},
+				},
+			},
+		}),
+	})
+	require.NoError(t, err)
+
+	operations := strings.Repeat(`{"query": "{ slow }"},`, 6)
+	w := postBatch(t, &schema, "["+strings.TrimSuffix(operations, ",")+"]")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var responses []testResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &responses))
+	assert.Len(t, responses, 6)
+	assert.Equal(t, 2, peak)
+}
@@ -0,0 +1,267 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"ozontz/app/storage"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// QueryLimits bounds the documents accepted by the GraphQL endpoints. They
+// are checked on the parsed document before it is executed; a zero value
+// disables the corresponding check.
+type QueryLimits struct {
+	MaxDepth   int `yaml:"max_depth"`
+	MaxAliases int `yaml:"max_aliases"`
+	MaxCost    int `yaml:"max_cost"`
+}
+
+var DefaultQueryLimits = QueryLimits{
+	MaxDepth:   15,
+	MaxAliases: 30,
+	MaxCost:    10000,
+}
+
+var limits = DefaultQueryLimits
+
+// SetQueryLimits replaces the limits of both endpoints. It is meant to be
+// called once at startup.
+func SetQueryLimits(l QueryLimits) {
+	limits = l
+}
+
+// fieldWeights is the cost of a field that reaches storage. Any other field
+// costs 1, introspection fields are free. commentThread is weighed per level
+// of the thread it reads.
+var fieldWeights = map[string]int{
+	"post":          2,
+	"posts":         5,
+	"comments":      5,
+	"replies":       5,
+	"lastComment":   2,
+	"commentThread": 5,
+}
+
+// defaultPageSize returns the page size of a connection field used when a
+// query asks for neither first nor last. The cost of its selection is
+// multiplied by the page size.
+func defaultPageSize(field string) (int, bool) {
+	switch field {
+	case "posts":
+		return storage.CurrentLimits().PostsPageSize, true
+	case "comments", "replies":
+		return storage.CurrentLimits().CommentsPageSize, true
+	}
+	return 0, false
+}
+
+// queryComplexity is the result of analyzing an operation: the nesting depth
+// of its fields, the number of aliased fields and its cost.
+type queryComplexity struct {
+	depth   int
+	aliases int
+	cost    int
+}
+
+func (c queryComplexity) add(other queryComplexity) queryComplexity {
+	return queryComplexity{
+		depth:   max(c.depth, other.depth),
+		aliases: saturate(c.aliases + other.aliases),
+		cost:    saturate(c.cost + other.cost),
+	}
+}
+
+// extensions reports the cost of a query in the extensions of a response.
+func (c *queryComplexity) extensions() map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	cost := map[string]interface{}{"requested": c.cost}
+	if limits.MaxCost > 0 {
+		cost["limit"] = limits.MaxCost
+	}
+	return map[string]interface{}{"cost": cost}
+}
+
+// checkQuery analyzes the operation a request executes and rejects it when
+// it exceeds the limits. Documents that can't be parsed are left to
+// graphql.Do, which reports them, so a nil complexity is returned for them.
+func checkQuery(query, operationName string, variables map[string]interface{}) (*queryComplexity, *requestError) {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return nil, nil
+	}
+
+	a := &complexityAnalyzer{
+		variables: variables,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		analyzed:  make(map[string]queryComplexity),
+		expanding: make(map[string]bool),
+	}
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operation == nil && (operationName == "" || (def.Name != nil && def.Name.Value == operationName)) {
+				operation = def
+			}
+		}
+	}
+	if operation == nil {
+		return nil, nil
+	}
+
+	c := a.selectionSet(operation.SelectionSet)
+	switch {
+	case limits.MaxDepth > 0 && c.depth > limits.MaxDepth:
+		return &c, tooComplex(fmt.Sprintf("query depth %d exceeds the limit of %d", c.depth, limits.MaxDepth))
+	case limits.MaxAliases > 0 && c.aliases > limits.MaxAliases:
+		return &c, tooComplex(fmt.Sprintf("query uses %d aliases, the limit is %d", c.aliases, limits.MaxAliases))
+	case limits.MaxCost > 0 && c.cost > limits.MaxCost:
+		return &c, tooComplex(fmt.Sprintf("query cost %d exceeds the limit of %d", c.cost, limits.MaxCost))
+	}
+	return &c, nil
+}
+
+func tooComplex(message string) *requestError {
+	return &requestError{code: codeQueryTooComplex, message: message}
+}
+
+type complexityAnalyzer struct {
+	variables map[string]interface{}
+	fragments map[string]*ast.FragmentDefinition
+
+	// Fragments are analyzed once, so spreading them repeatedly can't make
+	// the analysis itself expensive.
+	analyzed  map[string]queryComplexity
+	expanding map[string]bool
+}
+
+func (a *complexityAnalyzer) selectionSet(set *ast.SelectionSet) queryComplexity {
+	var c queryComplexity
+	if set == nil {
+		return c
+	}
+
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			c = c.add(a.field(selection))
+		case *ast.InlineFragment:
+			c = c.add(a.selectionSet(selection.SelectionSet))
+		case *ast.FragmentSpread:
+			c = c.add(a.fragment(selection.Name.Value))
+		}
+	}
+	return c
+}
+
+func (a *complexityAnalyzer) field(field *ast.Field) queryComplexity {
+	name := field.Name.Value
+	c := a.selectionSet(field.SelectionSet)
+	c.depth++
+	if field.Alias != nil {
+		c.aliases = saturate(c.aliases + 1)
+	}
+	if strings.HasPrefix(name, "__") {
+		// Introspection is free, but nesting it still counts towards the
+		// depth limit.
+		c.cost = 0
+		return c
+	}
+	if defaultSize, ok := defaultPageSize(name); ok {
+		c.cost = saturate(c.cost * a.pageSize(field, defaultSize))
+	}
+
+	weight, ok := fieldWeights[name]
+	if !ok {
+		weight = 1
+	}
+	c.cost = saturate(c.cost + weight)
+	if name == "commentThread" {
+		c.cost = saturate(c.cost * a.threadDepth(field))
+	}
+	return c
+}
+
+func (a *complexityAnalyzer) fragment(name string) queryComplexity {
+	if c, ok := a.analyzed[name]; ok {
+		return c
+	}
+	fragment, ok := a.fragments[name]
+	// Cycles are rejected by validation, they only have to terminate here.
+	if !ok || a.expanding[name] {
+		return queryComplexity{}
+	}
+
+	a.expanding[name] = true
+	c := a.selectionSet(fragment.SelectionSet)
+	delete(a.expanding, name)
+
+	a.analyzed[name] = c
+	return c
+}
+
+// pageSize returns the number of items a connection field asks for.
+func (a *complexityAnalyzer) pageSize(field *ast.Field, defaultSize int) int {
+	size := defaultSize
+	for _, arg := range field.Arguments {
+		if name := arg.Name.Value; name != "first" && name != "last" {
+			continue
+		}
+		if value, ok := a.intValue(arg.Value); ok {
+			size = value
+		}
+	}
+	return min(max(size, 0), storage.MaxPageSize)
+}
+
+// threadDepth returns the number of levels commentThread reads, normalized
+// like in storage.
+func (a *complexityAnalyzer) threadDepth(field *ast.Field) int {
+	depth := 0
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "depth" {
+			continue
+		}
+		if value, ok := a.intValue(arg.Value); ok {
+			depth = value
+		}
+	}
+	return storage.NormalizeDepth(depth)
+}
+
+func (a *complexityAnalyzer) intValue(value ast.Value) (int, bool) {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(value.Value)
+		return n, err == nil
+	case *ast.Variable:
+		switch n := a.variables[value.Name.Value].(type) {
+		case int:
+			return n, true
+		case float64:
+			return int(n), true
+		case json.Number:
+			i, err := n.Int64()
+			return int(i), err == nil
+		}
+	}
+	return 0, false
+}
+
+// saturate keeps counters of pathological documents from overflowing.
+func saturate(n int) int {
+	if n < 0 || n > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return n
+}
@@ -0,0 +1,144 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ozontz/app/storage"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withQueryLimits(t *testing.T, l QueryLimits) {
+	SetQueryLimits(l)
+	t.Cleanup(func() { SetQueryLimits(DefaultQueryLimits) })
+}
+
+func TestCheckQueryCost(t *testing.T) {
+	withQueryLimits(t, QueryLimits{})
+
+	c, err := checkQuery(`{ posts(first: 20) { edges { node { id lastComment { id } } } } }`, "", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 5, c.depth)
+	assert.Equal(t, 5+20*(1+1+1+2+1), c.cost, "the selection of posts is paid once per requested post")
+
+	c, err = checkQuery(`query Page($n: Int) { posts(first: $n) { totalCount } }`, "Page", map[string]interface{}{"n": float64(50)})
+	require.Nil(t, err)
+	assert.Equal(t, 5+50, c.cost)
+
+	c, err = checkQuery(`{ comments(postId: "post-1", last: 1000) { totalCount } }`, "", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 5+storage.MaxPageSize, c.cost, "page sizes are clamped like in storage")
+
+	c, err = checkQuery(`{ commentThread(postId: "post-1") { id } }`, "", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 3*(5+1), c.cost, "the thread is paid once per level of the default depth")
+
+	c, err = checkQuery(`query Thread($depth: Int) { commentThread(postId: "post-1", depth: $depth) { id text } }`, "Thread", map[string]interface{}{"depth": float64(1000)})
+	require.Nil(t, err)
+	assert.Equal(t, 10*(5+1+1), c.cost, "thread depths are clamped like in storage")
+
+	c, err = checkQuery(`{ __schema { types { name fields { name type { name ofType { name ofType { name } } } } } } }`, "", nil)
+	require.Nil(t, err)
+	assert.Zero(t, c.cost, "introspection should be free")
+
+	withQueryLimits(t, DefaultQueryLimits)
+	_, err = checkQuery(testutil.IntrospectionQuery, "", nil)
+	assert.Nil(t, err, "the default limits allow the introspection query of GraphQL tools")
+}
+
+func TestCheckQueryLimits(t *testing.T) {
+	withQueryLimits(t, QueryLimits{MaxDepth: 4, MaxAliases: 2, MaxCost: 100})
+
+	_, err := checkQuery(`{ comments(postId: "post-1") { edges { node { replies { totalCount } } } } }`, "", nil)
+	assert.EqualError(t, err, "query depth 5 exceeds the limit of 4")
+
+	_, err = checkQuery(`{ a: post(id: "1") { id } b: post(id: "2") { id } c: post(id: "3") { id } }`, "", nil)
+	assert.EqualError(t, err, "query uses 3 aliases, the limit is 2")
+
+	_, err = checkQuery(`{ posts(first: 50) { edges { node { id } } } }`, "", nil)
+	assert.EqualError(t, err, "query cost 155 exceeds the limit of 100")
+
+	_, err = checkQuery(`{ posts { edges { node { id } } } }`, "", nil)
+	assert.Nil(t, err)
+
+	_, err = checkQuery(`{ __schema { types { fields { type { ofType { name } } } } } }`, "", nil)
+	assert.EqualError(t, err, "query depth 6 exceeds the limit of 4", "introspection counts towards the depth")
+
+	c, err := checkQuery(`{ posts {`, "", nil)
+	assert.Nil(t, err, "syntax errors are reported by graphql.Do")
+	assert.Nil(t, c)
+}
+
+func TestCheckQueryFragments(t *testing.T) {
+	withQueryLimits(t, QueryLimits{MaxCost: 1000})
+
+	// Every fragment spreads the next one twice, doubling the cost per level.
+	var doc strings.Builder
+	doc.WriteString(`{ posts { ...F0 } }`)
+	for i := 0; i < 64; i++ {
+		fmt.Fprintf(&doc, ` fragment F%d on PostConnection { a%d: totalCount ...F%d ...F%d }`, i, i, i+1, i+1)
+	}
+	doc.WriteString(` fragment F64 on PostConnection { totalCount }`)
+
+	_, err := checkQuery(doc.String(), "", nil)
+	assert.ErrorContains(t, err, "exceeds the limit of 1000")
+
+	_, err = checkQuery(`{ posts { ...A } } fragment A on PostConnection { ...B } fragment B on PostConnection { ...A }`, "", nil)
+	assert.Nil(t, err, "fragment cycles are left to validation")
+}
+
+func TestGraphQLHandlerQueryLimits(t *testing.T) {
+	withQueryLimits(t, QueryLimits{MaxCost: 100})
+	SetStore(newCountingStore(nil, nil))
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: QueryType, Mutation: MutationType})
+	require.NoError(t, err)
+	handler := GraphQLHandler(&schema)
+
+	send := func(query, accept string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBuffer(body))
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		var resp struct {
+			Extensions map[string]interface{} `json:"extensions"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		return rr, resp.Extensions
+	}
+
+	t.Run("Within budget", func(t *testing.T) {
+		rr, extensions := send(`{ posts { totalCount } }`, mediaTypeGraphQLResponse)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, decodeResponse(t, rr).Errors)
+		assert.Equal(t, map[string]interface{}{"requested": float64(15), "limit": float64(100)}, extensions["cost"])
+	})
+
+	t.Run("Over budget", func(t *testing.T) {
+		rr, extensions := send(`{ posts(first: 100) { edges { node { id } } } }`, mediaTypeGraphQLResponse)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		resp := decodeResponse(t, rr)
+		assert.Nil(t, resp.Data)
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, "query cost 305 exceeds the limit of 100", resp.Errors[0].Message)
+		assert.Equal(t, codeQueryTooComplex, resp.Errors[0].Extensions["code"])
+		assert.Equal(t, float64(305), extensions["cost"].(map[string]interface{})["requested"])
+	})
+
+	t.Run("Over budget with application/json", func(t *testing.T) {
+		rr, _ := send(`{ posts(first: 100) { edges { node { id } } } }`, mediaTypeJSON)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Len(t, decodeResponse(t, rr).Errors, 1)
+	})
+}
@@ -0,0 +1,73 @@
+package graph
+
+import (
+	"ozontz/app/models"
+	"ozontz/app/storage"
+
+	"github.com/graphql-go/graphql"
+)
+
+type pageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type edge struct {
+	Cursor string      `json:"cursor"`
+	Node   interface{} `json:"node"`
+}
+
+type connection struct {
+	Edges      []edge   `json:"edges"`
+	PageInfo   pageInfo `json:"pageInfo"`
+	TotalCount int      `json:"totalCount"`
+}
+
+func pageArgs(params graphql.ResolveParams) storage.PageArgs {
+	var args storage.PageArgs
+	if first, ok := params.Args["first"].(int); ok {
+		args.First = &first
+	}
+	if after, ok := params.Args["after"].(string); ok && after != "" {
+		args.After = &after
+	}
+	if last, ok := params.Args["last"].(int); ok {
+		args.Last = &last
+	}
+	if before, ok := params.Args["before"].(string); ok && before != "" {
+		args.Before = &before
+	}
+	return args
+}
+
+func newConnection[T any](page *storage.Page[T], cursor func(T) string) *connection {
+	conn := &connection{
+		Edges:      make([]edge, 0, len(page.Items)),
+		TotalCount: page.TotalCount,
+		PageInfo: pageInfo{
+			HasNextPage:     page.HasNextPage,
+			HasPreviousPage: page.HasPreviousPage,
+		},
+	}
+
+	for _, item := range page.Items {
+		conn.Edges = append(conn.Edges, edge{Cursor: cursor(item), Node: item})
+	}
+
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
+
+	return conn
+}
+
+func postCursor(post *models.Post) string {
+	return storage.EncodeCursor(post.CreatedAt, post.ID)
+}
+
+func commentCursor(comment *models.Comment) string {
+	return storage.EncodeCursor(comment.CreatedAt, comment.ID)
+}
@@ -0,0 +1,123 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"ozontz/app/storage"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// Values of extensions.code in GraphQL errors.
+const (
+	codeNotFound         = "NOT_FOUND"
+	codeCommentsDisabled = "COMMENTS_DISABLED"
+	codeValidation       = "VALIDATION"
+	codeConflict         = "CONFLICT"
+	codeUnauthenticated  = "UNAUTHENTICATED"
+	codeForbidden        = "FORBIDDEN"
+	codeQueryTooComplex  = "QUERY_TOO_COMPLEX"
+	codeInternal         = "INTERNAL"
+
+	// Persisted queries. The first two are the codes Apollo clients expect.
+	codePersistedQueryNotFound     = "PERSISTED_QUERY_NOT_FOUND"
+	codePersistedQueryNotSupported = "PERSISTED_QUERY_NOT_SUPPORTED"
+	codePersistedQueryNotAllowed   = "PERSISTED_QUERY_NOT_ALLOWED"
+)
+
+const internalErrorMessage = "internal server error"
+
+// argumentError is an invalid argument caught by a resolver before it
+// reaches storage.
+type argumentError string
+
+func (e argumentError) Error() string {
+	return string(e)
+}
+
+func errorCode(err error) string {
+	var argErr argumentError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return codeNotFound
+	case errors.Is(err, storage.ErrCommentsDisabled):
+		return codeCommentsDisabled
+	case errors.Is(err, storage.ErrInvalidInput), errors.As(err, &argErr):
+		return codeValidation
+	case errors.Is(err, storage.ErrConflict):
+		return codeConflict
+	case errors.Is(err, errUnauthenticated):
+		return codeUnauthenticated
+	case errors.Is(err, errNotAuthor):
+		return codeForbidden
+	default:
+		return codeInternal
+	}
+}
+
+// resolverError returns the error a resolver failed with, or nil when err was
+// raised while parsing or validating the document.
+func resolverError(err gqlerrors.FormattedError) error {
+	located, ok := err.OriginalError().(*gqlerrors.Error)
+	if !ok {
+		return err.OriginalError()
+	}
+	return located.OriginalError
+}
+
+// isRequestError reports whether the document was rejected before execution,
+// in which case no data was produced.
+func isRequestError(errs []gqlerrors.FormattedError) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	for _, err := range errs {
+		if resolverError(err) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// withErrorCodes sets extensions.code on every error. Messages of internal
+// errors are replaced so storage details don't leak to clients.
+func withErrorCodes(ctx context.Context, errs []gqlerrors.FormattedError) []gqlerrors.FormattedError {
+	coded := make([]gqlerrors.FormattedError, 0, len(errs))
+	for _, err := range errs {
+		code := codeValidation
+		if original := resolverError(err); original != nil {
+			code = errorCode(original)
+			if code == codeInternal {
+				slog.ErrorContext(ctx, "Resolver error", "path", err.Path, "error", original)
+				err.Message = internalErrorMessage
+			}
+		}
+
+		extensions := make(map[string]interface{}, len(err.Extensions)+1)
+		for key, value := range err.Extensions {
+			extensions[key] = value
+		}
+		extensions["code"] = code
+		err.Extensions = extensions
+
+		coded = append(coded, err)
+	}
+	return coded
+}
+
+// requestError is a request refused before its document is executed.
+type requestError struct {
+	code    string
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func (e *requestError) formatted() gqlerrors.FormattedError {
+	formatted := gqlerrors.NewFormattedError(e.message)
+	formatted.Extensions = map[string]interface{}{"code": e.code}
+	return formatted
+}
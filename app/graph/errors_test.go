@@ -0,0 +1,48 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"ozontz/app/storage"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{storage.ErrPostNotFound, codeNotFound},
+		{storage.ErrCommentNotFound, codeNotFound},
+		{fmt.Errorf("loading post: %w", storage.ErrPostNotFound), codeNotFound},
+		{storage.ErrCommentsDisabled, codeCommentsDisabled},
+		{storage.ErrParentNotFound, codeNotFound},
+		{storage.ErrInvalidInput, codeValidation},
+		{storage.ErrInvalidCursor, codeValidation},
+		{storage.ErrTextTooLong, codeValidation},
+		{storage.ErrCommentDeleted, codeConflict},
+		{argumentError("postId is required"), codeValidation},
+		{errUnauthenticated, codeUnauthenticated},
+		{errNotAuthor, codeForbidden},
+		{errors.New("connection refused"), codeInternal},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, errorCode(tt.err), tt.err.Error())
+	}
+}
+
+func TestWithErrorCodesHidesInternalErrors(t *testing.T) {
+	located := gqlerrors.NewLocatedError(errors.New("pq: connection refused"), nil)
+
+	errs := withErrorCodes(context.Background(), []gqlerrors.FormattedError{gqlerrors.FormatError(located)})
+
+	assert.Len(t, errs, 1)
+	assert.Equal(t, internalErrorMessage, errs[0].Message)
+	assert.Equal(t, codeInternal, errs[0].Extensions["code"])
+}
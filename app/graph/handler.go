@@ -1,61 +1,287 @@
 package graph
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
 )
 
+// Media types of the GraphQL-over-HTTP spec:
+// https://graphql.github.io/graphql-over-http/draft/
+const (
+	mediaTypeJSON            = "application/json"
+	mediaTypeGraphQLResponse = "application/graphql-response+json"
+)
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    requestExtensions      `json:"extensions"`
+}
+
+type graphQLResponse struct {
+	Data       interface{}                `json:"data,omitempty"`
+	Errors     []gqlerrors.FormattedError `json:"errors,omitempty"`
+	Extensions map[string]interface{}     `json:"extensions,omitempty"`
+}
+
+// httpError is a request that could not be turned into a GraphQL request.
+type httpError struct {
+	status  int
+	message string
+}
+
 func GraphQLHandler(schema *graphql.Schema) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+		mediaType, ok := negotiateMediaType(r.Header.Get("Accept"))
+		if !ok {
+			writeRequestError(w, mediaTypeJSON, &httpError{http.StatusNotAcceptable, "Accept must allow application/graphql-response+json or application/json"})
+			return
+		}
+
+		requests, batch, reqErr := readRequest(r)
+		if reqErr != nil {
+			if reqErr.status == http.StatusMethodNotAllowed {
+				w.Header().Set("Allow", "GET, POST")
+			}
+			writeRequestError(w, mediaType, reqErr)
+			return
+		}
+
+		if batch {
+			writeResponse(w, mediaType, http.StatusOK, executeBatch(r.Context(), schema, mediaType, requests))
+			return
+		}
+
+		status, response := execute(r.Context(), schema, r.Method, mediaType, requests[0])
+		if status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", "POST")
+		}
+		writeResponse(w, mediaType, status, response)
+	}
+}
+
+// execute runs a single operation and returns its response along with the
+// status it gets when it is the only operation of a request.
+func execute(ctx context.Context, schema *graphql.Schema, method, mediaType string, params graphQLRequest) (status int, response graphQLResponse) {
+	ctx, span := startOperation(ctx)
+	start := time.Now()
+	defer func() {
+		op := findOperation(params.Query, params.OperationName)
+		observeOperation(ctx, op, params.OperationName, time.Since(start), response)
+		response = endOperation(span, op, params, response)
+	}()
+
+	query, register, reqError := resolvePersistedQuery(ctx, params.Query, params.Extensions.PersistedQuery)
+	if reqError != nil {
+		return requestErrorStatus(mediaType, reqError), graphQLResponse{
+			Errors: []gqlerrors.FormattedError{reqError.formatted()},
+		}
+	}
+	params.Query = query
+
+	if method == http.MethodGet && operationType(params.Query, params.OperationName) == ast.OperationTypeMutation {
+		return http.StatusMethodNotAllowed, validationResponse("Mutations must be sent with POST")
+	}
+
+	complexity, reqError := checkQuery(params.Query, params.OperationName, params.Variables)
+	if reqError != nil {
+		return requestErrorStatus(mediaType, reqError), graphQLResponse{
+			Errors:     []gqlerrors.FormattedError{reqError.formatted()},
+			Extensions: complexity.extensions(),
+		}
+	}
+	result := graphql.Do(graphql.Params{
+		Context:        withLatestCommentLoader(ctx),
+		Schema:         *schema,
+		RequestString:  params.Query,
+		OperationName:  params.OperationName,
+		VariableValues: params.Variables,
+	})
+
+	if register && len(result.Errors) == 0 {
+		registerPersistedQuery(ctx, params.Query)
+	}
+
+	// application/json clients expect 200 for anything that is a GraphQL
+	// response; the newer media type signals rejected documents with 400.
+	status = http.StatusOK
+	if mediaType == mediaTypeGraphQLResponse && isRequestError(result.Errors) {
+		status = http.StatusBadRequest
+	}
+
+	return status, graphQLResponse{
+		Data:       result.Data,
+		Errors:     withErrorCodes(ctx, result.Errors),
+		Extensions: complexity.extensions(),
+	}
+}
+
+// readRequest returns the operations of a request. A POST body holding a
+// JSON array is a batch of operations.
+func readRequest(r *http.Request) ([]graphQLRequest, bool, *httpError) {
+	var params graphQLRequest
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		params.Query = query.Get("query")
+		params.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &params.Variables); err != nil {
+				return nil, false, &httpError{http.StatusBadRequest, "Invalid variables parameter"}
+			}
+		}
+		if extensions := query.Get("extensions"); extensions != "" {
+			if err := json.Unmarshal([]byte(extensions), &params.Extensions); err != nil {
+				return nil, false, &httpError{http.StatusBadRequest, "Invalid extensions parameter"}
+			}
+		}
+
+	case http.MethodPost:
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			mediaType, _, err := mime.ParseMediaType(contentType)
+			if err != nil || mediaType != mediaTypeJSON {
+				return nil, false, &httpError{http.StatusUnsupportedMediaType, "Content-Type must be application/json"}
+			}
+		}
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
-			return
+			return nil, false, &httpError{http.StatusBadRequest, "Failed to read request body"}
 		}
 		defer r.Body.Close()
 
+		body = bytes.TrimSpace(body)
 		if len(body) == 0 {
-			http.Error(w, "Request body is empty", http.StatusBadRequest)
-			return
+			return nil, false, &httpError{http.StatusBadRequest, "Request body is empty"}
 		}
-
-		var params struct {
-			Query         string                 `json:"query"`
-			OperationName string                 `json:"operationName"`
-			Variables     map[string]interface{} `json:"variables"`
+		if body[0] == '[' {
+			requests, err := readBatch(body)
+			return requests, true, err
 		}
 		if err := json.Unmarshal(body, &params); err != nil {
-			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
-			return
+			return nil, false, &httpError{http.StatusBadRequest, "Invalid JSON payload"}
 		}
 
-		result := graphql.Do(graphql.Params{
-			Context:        context.Background(),
-			Schema:         *schema,
-			RequestString:  params.Query,
-			OperationName:  params.OperationName,
-			VariableValues: params.Variables,
-		})
+	default:
+		return nil, false, &httpError{http.StatusMethodNotAllowed, "Only GET and POST are supported"}
+	}
 
-		if len(result.Errors) > 0 {
-			log.Printf("GraphQL errors: %v\n", result.Errors)
-			http.Error(w, fmt.Sprintf("GraphQL errors: %v", result.Errors), http.StatusBadRequest)
-			return
+	if err := checkOperation(params); err != nil {
+		return nil, false, err
+	}
+	return []graphQLRequest{params}, false, nil
+}
+
+func checkOperation(params graphQLRequest) *httpError {
+	if params.Query == "" && params.Extensions.PersistedQuery == nil {
+		return &httpError{http.StatusBadRequest, "Query is required"}
+	}
+	return nil
+}
+
+// negotiateMediaType picks the response media type for an Accept header.
+// Clients that send none are assumed to be legacy application/json clients.
+func negotiateMediaType(accept string) (string, bool) {
+	if accept == "" {
+		return mediaTypeJSON, true
+	}
+
+	acceptsJSON := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case mediaTypeGraphQLResponse:
+			return mediaTypeGraphQLResponse, true
+		case mediaTypeJSON, "application/*", "*/*":
+			acceptsJSON = true
 		}
+	}
 
-		response, err := json.Marshal(result)
-		if err != nil {
-			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-			return
+	if acceptsJSON {
+		return mediaTypeJSON, true
+	}
+	return "", false
+}
+
+// requestErrorStatus follows the status rules of graphql.Do results for
+// requests refused before execution.
+func requestErrorStatus(mediaType string, err *requestError) int {
+	switch {
+	case err.code == codeInternal:
+		return http.StatusInternalServerError
+	case mediaType == mediaTypeGraphQLResponse:
+		return http.StatusBadRequest
+	default:
+		return http.StatusOK
+	}
+}
+
+func writeRequestError(w http.ResponseWriter, mediaType string, err *httpError) {
+	writeResponse(w, mediaType, err.status, validationResponse(err.message))
+}
+
+func validationResponse(message string) graphQLResponse {
+	formatted := gqlerrors.NewFormattedError(message)
+	formatted.Extensions = map[string]interface{}{"code": codeValidation}
+	return graphQLResponse{Errors: []gqlerrors.FormattedError{formatted}}
+}
+
+// writeResponse writes a graphQLResponse, or a slice of them for a batch.
+func writeResponse(w http.ResponseWriter, mediaType string, status int, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		slog.Error("Failed to marshal response", "error", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// operationType returns the type of the operation a request executes, or an
+// empty string when the document can't be parsed or has no such operation.
+func operationType(query, operationName string) string {
+	if op := findOperation(query, operationName); op != nil {
+		return op.Operation
+	}
+	return ""
+}
+
+// findOperation returns the operation a request executes, or nil when the
+// document can't be parsed or has no such operation.
+func findOperation(query, operationName string) *ast.OperationDefinition {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return nil
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return op
 		}
-		w.Write(response)
 	}
+	return nil
 }
@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
+	"ozontz/app/storage"
+
 	"github.com/graphql-go/graphql"
 	"github.com/stretchr/testify/assert"
 )
@@ -21,10 +24,42 @@ var mockSchema, _ = graphql.NewSchema(graphql.SchemaConfig{
 					return "world", nil
 				},
 			},
+			"missing": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return nil, storage.ErrPostNotFound
+				},
+			},
+		},
+	}),
+	Mutation: graphql.NewObject(graphql.ObjectConfig{
+		Name: "RootMutation",
+		Fields: graphql.Fields{
+			"touch": &graphql.Field{
+				Type: graphql.Boolean,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return true, nil
+				},
+			},
 		},
 	}),
 })
 
+type testResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) testResponse {
+	var response testResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
 func TestGraphQLHandler(t *testing.T) {
 	handler := GraphQLHandler(&mockSchema)
 
@@ -70,9 +105,115 @@ func TestGraphQLHandler(t *testing.T) {
 
 		handler(w, req)
 
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+		response := decodeResponse(t, w)
+		assert.Nil(t, response.Data)
+		assert.Len(t, response.Errors, 1)
+		assert.Contains(t, response.Errors[0].Message, "invalidField")
+		assert.Equal(t, "VALIDATION", response.Errors[0].Extensions["code"])
+	})
+
+	t.Run("GraphQL errors with graphql-response+json", func(t *testing.T) {
+		requestBody := `{"query": "{ invalidField }"}`
+
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(requestBody))
+		req.Header.Set("Accept", "application/graphql-response+json, application/json;q=0.9")
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/graphql-response+json; charset=utf-8", w.Header().Get("Content-Type"))
+
+		response := decodeResponse(t, w)
+		assert.Len(t, response.Errors, 1)
+		assert.Equal(t, "VALIDATION", response.Errors[0].Extensions["code"])
+	})
+
+	t.Run("Partial data", func(t *testing.T) {
+		requestBody := `{"query": "{ hello missing }"}`
+
+		for _, accept := range []string{"application/json", "application/graphql-response+json"} {
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(requestBody))
+			req.Header.Set("Accept", accept)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code, accept)
+
+			response := decodeResponse(t, w)
+			assert.Equal(t, "world", response.Data["hello"])
+			assert.Nil(t, response.Data["missing"])
+			assert.Len(t, response.Errors, 1)
+			assert.Equal(t, "post not found", response.Errors[0].Message)
+			assert.Equal(t, []interface{}{"missing"}, response.Errors[0].Path)
+			assert.Equal(t, "NOT_FOUND", response.Errors[0].Extensions["code"])
+		}
+	})
+
+	t.Run("Not acceptable", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query": "{ hello }"}`))
+		req.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	})
+
+	t.Run("Unsupported content type", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query": "{ hello }"}`))
+		req.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	t.Run("GET query", func(t *testing.T) {
+		target := "/query?" + url.Values{"query": {"query Hello { hello }"}, "operationName": {"Hello"}}.Encode()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "world", decodeResponse(t, w).Data["hello"])
+	})
+
+	t.Run("GET with invalid variables", func(t *testing.T) {
+		target := "/query?" + url.Values{"query": {"{ hello }"}, "variables": {"{"}}.Encode()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
 		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("GET mutation", func(t *testing.T) {
+		target := "/query?" + url.Values{"query": {"mutation { touch }"}}.Encode()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
 
-		assert.Contains(t, w.Body.String(), "GraphQL errors")
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "POST", w.Header().Get("Allow"))
+	})
+
+	t.Run("Unsupported method", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/query", bytes.NewBufferString(`{"query": "{ hello }"}`))
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "GET, POST", w.Header().Get("Allow"))
 	})
 
 	t.Run("Missing request body", func(t *testing.T) {
@@ -85,4 +226,14 @@ func TestGraphQLHandler(t *testing.T) {
 
 		assert.Contains(t, w.Body.String(), "Request body is empty")
 	})
+
+	t.Run("Whitespace-only request body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(" \n\t "))
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Request body is empty")
+	})
 }
@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"context"
+	"ozontz/app/models"
+	"slices"
+	"sync"
+)
+
+type latestCommentLoaderKey struct{}
+
+// latestCommentLoader batches the lastComment lookups of one request. The
+// resolver only registers a post and returns a thunk; graphql-go calls
+// thunks after every post of the list was resolved, so the first of them
+// loads all registered posts with a single GetLatestComments call.
+type latestCommentLoader struct {
+	ctx context.Context
+
+	mu      sync.Mutex
+	pending []string
+	loaded  map[string]latestCommentResult
+}
+
+type latestCommentResult struct {
+	comment *models.Comment
+	err     error
+}
+
+func withLatestCommentLoader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, latestCommentLoaderKey{}, &latestCommentLoader{
+		ctx:    ctx,
+		loaded: make(map[string]latestCommentResult),
+	})
+}
+
+func latestCommentLoaderFromContext(ctx context.Context) (*latestCommentLoader, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	loader, ok := ctx.Value(latestCommentLoaderKey{}).(*latestCommentLoader)
+	return loader, ok
+}
+
+func (l *latestCommentLoader) load(postId string) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, done := l.loaded[postId]; !done && !slices.Contains(l.pending, postId) {
+		l.pending = append(l.pending, postId)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			l.flush()
+		}
+
+		result := l.loaded[postId]
+		if result.err != nil {
+			return nil, result.err
+		}
+		if result.comment == nil {
+			return nil, nil
+		}
+		return result.comment, nil
+	}
+}
+
+// flush loads every pending post. It must be called with l.mu held.
+func (l *latestCommentLoader) flush() {
+	batch := l.pending
+	l.pending = nil
+
+	latest, err := store.GetLatestComments(l.ctx, batch)
+	for _, postId := range batch {
+		l.loaded[postId] = latestCommentResult{comment: latest[postId], err: err}
+	}
+}
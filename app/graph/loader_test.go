@@ -0,0 +1,122 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ozontz/app/models"
+	"ozontz/app/storage"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore serves a page of posts and counts the lastComment lookups
+// made while resolving it.
+type countingStore struct {
+	MockStorage
+
+	batches  [][]string
+	single   int
+	batchErr error
+}
+
+func newCountingStore(posts []*models.Post, latest map[string]*models.Comment) *countingStore {
+	s := &countingStore{}
+	s.GetPostsFn = func(ctx context.Context, page storage.PageArgs) (*storage.Page[*models.Post], error) {
+		return &storage.Page[*models.Post]{Items: posts, TotalCount: len(posts)}, nil
+	}
+	s.GetLatestCommentFn = func(ctx context.Context, postId string) (*models.Comment, error) {
+		s.single++
+		return latest[postId], nil
+	}
+	s.GetLatestCommentsFn = func(ctx context.Context, postIds []string) (map[string]*models.Comment, error) {
+		s.batches = append(s.batches, postIds)
+		if s.batchErr != nil {
+			return nil, s.batchErr
+		}
+		return latest, nil
+	}
+	return s
+}
+
+func queryLastComments(t *testing.T) *httptest.ResponseRecorder {
+	t.Helper()
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: QueryType, Mutation: MutationType})
+	require.NoError(t, err)
+
+	body := bytes.NewBufferString(`{"query": "{ posts { edges { node { id lastComment { id } } } } }"}`)
+	rr := httptest.NewRecorder()
+	GraphQLHandler(&schema).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/query", body))
+	require.Equal(t, http.StatusOK, rr.Code)
+	return rr
+}
+
+func TestLastCommentIsBatched(t *testing.T) {
+	posts := []*models.Post{
+		{ID: "post-1", AllowComments: true},
+		{ID: "post-2", AllowComments: true},
+		{ID: "post-3", AllowComments: false},
+		{ID: "post-4", AllowComments: true},
+	}
+	latest := map[string]*models.Comment{
+		"post-1": {ID: "com-1", PostID: "post-1"},
+		"post-2": {ID: "com-2", PostID: "post-2"},
+	}
+	mockStore := newCountingStore(posts, latest)
+	SetStore(mockStore)
+
+	rr := queryLastComments(t)
+	require.Empty(t, decodeResponse(t, rr).Errors)
+
+	assert.Zero(t, mockStore.single, "GetLatestComment should not be called per post")
+	require.Len(t, mockStore.batches, 1, "all posts should be loaded with one query")
+	assert.ElementsMatch(t, []string{"post-1", "post-2", "post-4"}, mockStore.batches[0])
+
+	var resp struct {
+		Data struct {
+			Posts struct {
+				Edges []struct {
+					Node struct {
+						ID          string
+						LastComment *struct{ ID string }
+					}
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	edges := resp.Data.Posts.Edges
+	require.Len(t, edges, 4)
+	require.NotNil(t, edges[0].Node.LastComment)
+	assert.Equal(t, "com-1", edges[0].Node.LastComment.ID)
+	require.NotNil(t, edges[1].Node.LastComment)
+	assert.Equal(t, "com-2", edges[1].Node.LastComment.ID)
+	assert.Nil(t, edges[2].Node.LastComment)
+	assert.Nil(t, edges[3].Node.LastComment)
+}
+
+func TestLastCommentBatchError(t *testing.T) {
+	posts := []*models.Post{
+		{ID: "post-1", AllowComments: true},
+		{ID: "post-2", AllowComments: true},
+	}
+	mockStore := newCountingStore(posts, nil)
+	mockStore.batchErr = errors.New("connection reset")
+	SetStore(mockStore)
+
+	resp := decodeResponse(t, queryLastComments(t))
+
+	assert.Len(t, mockStore.batches, 1, "a failed batch should not be retried per post")
+	require.Len(t, resp.Errors, 2, "every post of the batch reports the error")
+	for _, err := range resp.Errors {
+		assert.Equal(t, codeInternal, err.Extensions["code"])
+	}
+}
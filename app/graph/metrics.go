@@ -0,0 +1,40 @@
+package graph
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"ozontz/app/logging"
+	"ozontz/app/metrics"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// observeOperation records an operation executed by GraphQLHandler, along
+// with the codes of the errors it returned, and logs it. Neither the
+// document nor its variables are logged.
+func observeOperation(ctx context.Context, op *ast.OperationDefinition, name string, duration time.Duration, response graphQLResponse) {
+	operationType := ""
+	if op != nil {
+		operationType = op.Operation
+		if op.Name != nil {
+			name = op.Name.Value
+		}
+	}
+
+	codes := make([]string, 0, len(response.Errors))
+	for _, err := range response.Errors {
+		if code, ok := err.Extensions["code"].(string); ok {
+			codes = append(codes, code)
+		}
+	}
+
+	metrics.ObserveOperation(name, operationType, duration, codes)
+	slog.InfoContext(ctx, "GraphQL operation executed",
+		"operation", name,
+		"type", operationType,
+		"duration_ms", logging.DurationMillis(duration),
+		"errors", codes,
+	)
+}
@@ -0,0 +1,47 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ozontz/app/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationIsLogged(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Level: "info", Format: logging.FormatJSON})
+	require.NoError(t, err)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	body := `{"query": "query Greeting($name: String) { hello }", "variables": {"name": "private value"}}`
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(body))
+	req.Header.Set(logging.RequestIDHeader, "req-1")
+	rr := httptest.NewRecorder()
+	logging.Middleware(GraphQLHandler(&mockSchema)).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	assert.NotContains(t, buf.String(), "private value")
+
+	var record map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		if record["msg"] == "GraphQL operation executed" {
+			break
+		}
+	}
+	assert.Equal(t, "GraphQL operation executed", record["msg"])
+	assert.Equal(t, "req-1", record["request_id"])
+	assert.Equal(t, "Greeting", record["operation"])
+	assert.Equal(t, "query", record["type"])
+	assert.Contains(t, record, "duration_ms")
+}
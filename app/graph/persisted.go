@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"context"
+	"log/slog"
+
+	"ozontz/app/persisted"
+)
+
+// requestExtensions is the extensions object of a GraphQL request.
+type requestExtensions struct {
+	PersistedQuery *persistedQuery `json:"persistedQuery"`
+}
+
+// persistedQuery refers to a document by its hash, see
+// https://github.com/apollographql/apollo-link-persisted-queries#protocol
+type persistedQuery struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+var (
+	persistedQueries persisted.Store
+	allowListOnly    bool
+)
+
+// SetPersistedQueries lets clients send the hash of a document stored in
+// store instead of the document. Clients register documents by sending them
+// along with their hash, unless allowList is set: then only documents that
+// were put into the store beforehand are executed.
+func SetPersistedQueries(store persisted.Store, allowList bool) {
+	persistedQueries = store
+	allowListOnly = allowList
+}
+
+// resolvePersistedQuery returns the document a request executes and whether
+// it is to be registered, which happens once it executed without errors.
+func resolvePersistedQuery(ctx context.Context, query string, ext *persistedQuery) (string, bool, *requestError) {
+	if ext == nil {
+		if query == "" || !allowListOnly || persistedQueries == nil {
+			return query, false, nil
+		}
+		return query, false, lookupAllowed(ctx, persisted.Hash(query))
+	}
+
+	if persistedQueries == nil {
+		if query != "" {
+			return query, false, nil
+		}
+		return "", false, &requestError{code: codePersistedQueryNotSupported, message: "PersistedQueryNotSupported"}
+	}
+	if ext.Version != 1 {
+		return "", false, &requestError{code: codeValidation, message: "Unsupported persisted query version"}
+	}
+
+	if query != "" {
+		if persisted.Hash(query) != ext.Sha256Hash {
+			return "", false, &requestError{code: codeValidation, message: "provided sha256Hash does not match query"}
+		}
+		if allowListOnly {
+			return query, false, lookupAllowed(ctx, ext.Sha256Hash)
+		}
+		return query, true, nil
+	}
+
+	stored, ok, err := persistedQueries.Get(ctx, ext.Sha256Hash)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get persisted query", "hash", ext.Sha256Hash, "error", err)
+		return "", false, &requestError{code: codeInternal, message: internalErrorMessage}
+	}
+	if !ok {
+		if allowListOnly {
+			return "", false, notAllowed()
+		}
+		return "", false, &requestError{code: codePersistedQueryNotFound, message: "PersistedQueryNotFound"}
+	}
+	return stored, false, nil
+}
+
+func lookupAllowed(ctx context.Context, hash string) *requestError {
+	_, ok, err := persistedQueries.Get(ctx, hash)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get persisted query", "hash", hash, "error", err)
+		return &requestError{code: codeInternal, message: internalErrorMessage}
+	}
+	if !ok {
+		return notAllowed()
+	}
+	return nil
+}
+
+func notAllowed() *requestError {
+	return &requestError{code: codePersistedQueryNotAllowed, message: "Only approved persisted queries are allowed"}
+}
+
+func registerPersistedQuery(ctx context.Context, query string) {
+	if err := persistedQueries.Put(ctx, persisted.Hash(query), query); err != nil {
+		slog.ErrorContext(ctx, "Failed to register persisted query", "error", err)
+	}
+}
@@ -0,0 +1,132 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ozontz/app/persisted"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withPersistedQueries(t *testing.T, store persisted.Store, allowList bool) {
+	SetPersistedQueries(store, allowList)
+	t.Cleanup(func() { SetPersistedQueries(nil, false) })
+}
+
+func postPersisted(t *testing.T, query, hash string) testResponse {
+	request := map[string]interface{}{
+		"extensions": map[string]interface{}{
+			"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hash},
+		},
+	}
+	if query != "" {
+		request["query"] = query
+	}
+	body, err := json.Marshal(request)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	GraphQLHandler(&mockSchema)(w, httptest.NewRequest(http.MethodPost, "/query", bytes.NewBuffer(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+	return decodeResponse(t, w)
+}
+
+func TestAutomaticPersistedQueries(t *testing.T) {
+	store := persisted.NewLRU(10)
+	withPersistedQueries(t, store, false)
+	query := "{ hello }"
+
+	resp := postPersisted(t, "", persisted.Hash(query))
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "PersistedQueryNotFound", resp.Errors[0].Message)
+	assert.Equal(t, codePersistedQueryNotFound, resp.Errors[0].Extensions["code"])
+
+	resp = postPersisted(t, query, persisted.Hash(query))
+	require.Empty(t, resp.Errors)
+	assert.Equal(t, "world", resp.Data["hello"])
+
+	resp = postPersisted(t, "", persisted.Hash(query))
+	require.Empty(t, resp.Errors)
+	assert.Equal(t, "world", resp.Data["hello"])
+
+	t.Run("GET", func(t *testing.T) {
+		params := url.Values{"extensions": {`{"persistedQuery":{"version":1,"sha256Hash":"` + persisted.Hash(query) + `"}}`}}
+		w := httptest.NewRecorder()
+		GraphQLHandler(&mockSchema)(w, httptest.NewRequest(http.MethodGet, "/query?"+params.Encode(), nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "world", decodeResponse(t, w).Data["hello"])
+	})
+
+	t.Run("Hash mismatch", func(t *testing.T) {
+		resp := postPersisted(t, "{ missing }", persisted.Hash(query))
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, codeValidation, resp.Errors[0].Extensions["code"])
+
+		_, ok, _ := store.Get(context.Background(), persisted.Hash("{ missing }"))
+		assert.False(t, ok)
+	})
+
+	t.Run("Invalid document is not registered", func(t *testing.T) {
+		resp := postPersisted(t, "{ hello", persisted.Hash("{ hello"))
+		require.NotEmpty(t, resp.Errors)
+
+		_, ok, _ := store.Get(context.Background(), persisted.Hash("{ hello"))
+		assert.False(t, ok)
+	})
+
+	t.Run("Document failing validation is not registered", func(t *testing.T) {
+		resp := postPersisted(t, "{ missing }", persisted.Hash("{ missing }"))
+		require.NotEmpty(t, resp.Errors)
+
+		_, ok, _ := store.Get(context.Background(), persisted.Hash("{ missing }"))
+		assert.False(t, ok)
+	})
+}
+
+func TestPersistedQueriesAllowList(t *testing.T) {
+	store := persisted.NewLRU(0)
+	require.NoError(t, store.Put(context.Background(), persisted.Hash("{ hello }"), "{ hello }"))
+	withPersistedQueries(t, store, true)
+
+	resp := postPersisted(t, "", persisted.Hash("{ hello }"))
+	require.Empty(t, resp.Errors)
+	assert.Equal(t, "world", resp.Data["hello"])
+
+	resp = postPersisted(t, "{ missing }", persisted.Hash("{ missing }"))
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, codePersistedQueryNotAllowed, resp.Errors[0].Extensions["code"])
+	_, ok, _ := store.Get(context.Background(), persisted.Hash("{ missing }"))
+	assert.False(t, ok, "clients can't register queries in allow-list mode")
+
+	t.Run("Plain query", func(t *testing.T) {
+		send := func(query string) testResponse {
+			body, _ := json.Marshal(map[string]string{"query": query})
+			w := httptest.NewRecorder()
+			GraphQLHandler(&mockSchema)(w, httptest.NewRequest(http.MethodPost, "/query", bytes.NewBuffer(body)))
+			return decodeResponse(t, w)
+		}
+
+		assert.Empty(t, send("{ hello }").Errors, "approved documents may be sent in full")
+		resp := send("{ touch }")
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, codePersistedQueryNotAllowed, resp.Errors[0].Extensions["code"])
+	})
+}
+
+func TestPersistedQueriesNotSupported(t *testing.T) {
+	resp := postPersisted(t, "", persisted.Hash("{ hello }"))
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "PersistedQueryNotSupported", resp.Errors[0].Message)
+	assert.Equal(t, codePersistedQueryNotSupported, resp.Errors[0].Extensions["code"])
+
+	resp = postPersisted(t, "{ hello }", persisted.Hash("{ hello }"))
+	assert.Empty(t, resp.Errors, "the hash is ignored when the query is sent")
+}
@@ -1,9 +1,10 @@
 package graph
 
 import (
-	"context"
 	"errors"
+	"ozontz/app/auth"
 	"ozontz/app/models"
+	"ozontz/app/pubsub"
 	"ozontz/app/storage"
 	"time"
 
@@ -12,14 +13,45 @@ import (
 
 var store storage.Storage
 
+var (
+	errUnauthenticated = errors.New("authentication required")
+	errNotAuthor       = errors.New("only the author can modify this content")
+)
+
+var broker pubsub.Broker = pubsub.NewHub()
+
 func SetStore(s storage.Storage) {
 	store = s
 }
 
+func SetBroker(b pubsub.Broker) {
+	broker = b
+}
+
+func viewerID(params graphql.ResolveParams) (string, error) {
+	viewer, ok := auth.ViewerFromContext(params.Context)
+	if !ok {
+		return "", errUnauthenticated
+	}
+	return viewer.ID, nil
+}
+
+func resolveViewer(params graphql.ResolveParams) (interface{}, error) {
+	viewer, ok := auth.ViewerFromContext(params.Context)
+	if !ok {
+		return nil, nil
+	}
+	return viewer, nil
+}
+
 func resolveCreatePost(params graphql.ResolveParams) (interface{}, error) {
+	authorId, err := viewerID(params)
+	if err != nil {
+		return nil, err
+	}
+
 	title := params.Args["title"].(string)
 	content := params.Args["content"].(string)
-	authorId := params.Args["authorId"].(string)
 	allowComments := params.Args["allowComments"].(bool)
 
 	post := &models.Post{
@@ -29,15 +61,15 @@ func resolveCreatePost(params graphql.ResolveParams) (interface{}, error) {
 		AllowComments: allowComments,
 		CreatedAt:     time.Now(),
 	}
-	return store.CreatePost(context.Background(), post)
+	return store.CreatePost(params.Context, post)
 }
 
 func resolveGetPost(params graphql.ResolveParams) (interface{}, error) {
 	id, ok := params.Args["id"].(string)
 	if !ok {
-		return nil, errors.New("invalid ID")
+		return nil, argumentError("invalid ID")
 	}
-	post, err := store.GetPostByID(context.Background(), id)
+	post, err := store.GetPostByID(params.Context, id)
 	if err != nil {
 		return nil, err
 	}
@@ -45,21 +77,26 @@ func resolveGetPost(params graphql.ResolveParams) (interface{}, error) {
 }
 
 func resolveGetPostsList(params graphql.ResolveParams) (interface{}, error) {
-	posts, err := store.GetPosts(context.Background())
+	posts, err := store.GetPosts(params.Context, pageArgs(params))
 	if err != nil {
 		return nil, err
 	}
-	return posts, nil
+	return newConnection(posts, postCursor), nil
 }
 
 func resolveAddComment(params graphql.ResolveParams) (interface{}, error) {
+	authorId, err := viewerID(params)
+	if err != nil {
+		return nil, err
+	}
+
 	rawPostID := params.Args["postId"]
 	if rawPostID == nil {
-		return nil, errors.New("postId is required")
+		return nil, argumentError("postId is required")
 	}
 	postId, ok := rawPostID.(string)
 	if !ok {
-		return nil, errors.New("postId must be a string")
+		return nil, argumentError("postId must be a string")
 	}
 
 	rawParentID := params.Args["parentId"]
@@ -67,27 +104,18 @@ func resolveAddComment(params graphql.ResolveParams) (interface{}, error) {
 	if rawParentID != nil {
 		parentIdStr, ok := rawParentID.(string)
 		if !ok {
-			return nil, errors.New("parentId must be a string")
+			return nil, argumentError("parentId must be a string")
 		}
 		parentID = &parentIdStr
 	}
 
-	rawAuthorID := params.Args["authorId"]
-	if rawAuthorID == nil {
-		return nil, errors.New("authorId is required")
-	}
-	authorId, ok := rawAuthorID.(string)
-	if !ok {
-		return nil, errors.New("authorId must be a string")
-	}
-
 	rawText := params.Args["text"]
 	if rawText == nil {
-		return nil, errors.New("text is required")
+		return nil, argumentError("text is required")
 	}
 	text, ok := rawText.(string)
 	if !ok {
-		return nil, errors.New("text must be a string")
+		return nil, argumentError("text must be a string")
 	}
 
 	comment := &models.Comment{
@@ -98,7 +126,124 @@ func resolveAddComment(params graphql.ResolveParams) (interface{}, error) {
 		CreatedAt: time.Now(),
 	}
 
-	return store.AddComment(context.Background(), comment)
+	created, err := store.AddComment(params.Context, comment)
+	if err != nil {
+		return nil, err
+	}
+	broker.Publish(created)
+
+	return created, nil
+}
+
+func resolveUpdatePost(params graphql.ResolveParams) (interface{}, error) {
+	authorId, err := viewerID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := params.Args["id"].(string)
+
+	post, err := store.GetPostByID(params.Context, id)
+	if err != nil {
+		return nil, err
+	}
+	if post.AuthorID != authorId {
+		return nil, errNotAuthor
+	}
+
+	var title, content *string
+	if t, ok := params.Args["title"].(string); ok {
+		title = &t
+	}
+	if c, ok := params.Args["content"].(string); ok {
+		content = &c
+	}
+
+	return store.UpdatePost(params.Context, id, title, content)
+}
+
+func resolveSetCommentsAllowed(params graphql.ResolveParams) (interface{}, error) {
+	authorId, err := viewerID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	postId, _ := params.Args["postId"].(string)
+	allowed, _ := params.Args["allowed"].(bool)
+
+	post, err := store.GetPostByID(params.Context, postId)
+	if err != nil {
+		return nil, err
+	}
+	if post.AuthorID != authorId {
+		return nil, errNotAuthor
+	}
+
+	return store.SetCommentsAllowed(params.Context, postId, allowed)
+}
+
+func resolveDeletePost(params graphql.ResolveParams) (interface{}, error) {
+	authorId, err := viewerID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := params.Args["id"].(string)
+
+	post, err := store.GetPostByID(params.Context, id)
+	if err != nil {
+		return nil, err
+	}
+	if post.AuthorID != authorId {
+		return nil, errNotAuthor
+	}
+
+	if err := store.DeletePost(params.Context, id); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func resolveUpdateComment(params graphql.ResolveParams) (interface{}, error) {
+	authorId, err := viewerID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := params.Args["id"].(string)
+	text, _ := params.Args["text"].(string)
+
+	comment, err := store.GetCommentByID(params.Context, id)
+	if err != nil {
+		return nil, err
+	}
+	if comment.AuthorID != authorId {
+		return nil, errNotAuthor
+	}
+
+	return store.UpdateComment(params.Context, id, text)
+}
+
+func resolveDeleteComment(params graphql.ResolveParams) (interface{}, error) {
+	authorId, err := viewerID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := params.Args["id"].(string)
+
+	comment, err := store.GetCommentByID(params.Context, id)
+	if err != nil {
+		return nil, err
+	}
+	if comment.AuthorID != authorId {
+		return nil, errNotAuthor
+	}
+
+	if err := store.DeleteComment(params.Context, id); err != nil {
+		return nil, err
+	}
+	return true, nil
 }
 
 func resolveGetLastComment(params graphql.ResolveParams) (interface{}, error) {
@@ -111,7 +256,11 @@ func resolveGetLastComment(params graphql.ResolveParams) (interface{}, error) {
 		return nil, nil
 	}
 
-	lastComment, err := store.GetLatestComment(context.Background(), post.ID)
+	if loader, ok := latestCommentLoaderFromContext(params.Context); ok {
+		return loader.load(post.ID), nil
+	}
+
+	lastComment, err := store.GetLatestComment(params.Context, post.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -122,23 +271,109 @@ func resolveGetLastComment(params graphql.ResolveParams) (interface{}, error) {
 func resolveGetComments(params graphql.ResolveParams) (interface{}, error) {
 	postId, ok := params.Args["postId"].(string)
 	if !ok || postId == "" {
-		return nil, errors.New("postId is required")
+		return nil, argumentError("postId is required")
 	}
 
-	rawAfter := params.Args["after"]
-	var after *string
+	comments, err := store.GetComments(params.Context, postId, pageArgs(params))
+	if err != nil {
+		return nil, err
+	}
 
-	if rawAfter != nil {
-		a, ok := rawAfter.(string)
-		if ok && a != "" {
-			after = &a
-		}
+	return newConnection(comments, commentCursor), nil
+}
+
+func resolveGetReplies(params graphql.ResolveParams) (interface{}, error) {
+	comment, ok := params.Source.(*models.Comment)
+	if !ok {
+		return nil, errors.New("invalid source type")
+	}
+
+	replies, err := store.GetReplies(params.Context, comment.ID, pageArgs(params))
+	if err != nil {
+		return nil, err
+	}
+
+	return newConnection(replies, commentCursor), nil
+}
+
+func resolveGetCommentThread(params graphql.ResolveParams) (interface{}, error) {
+	postId, ok := params.Args["postId"].(string)
+	if !ok || postId == "" {
+		return nil, argumentError("postId is required")
 	}
 
-	comments, err := store.GetComments(context.Background(), postId, after)
+	depth, _ := params.Args["depth"].(int)
+
+	comments, err := store.GetCommentThread(params.Context, postId, depth)
 	if err != nil {
 		return nil, err
 	}
 
-	return comments, nil
+	return buildCommentThread(comments), nil
+}
+
+func buildCommentThread(comments []*models.Comment) []*models.CommentThread {
+	nodes := make(map[string]*models.CommentThread, len(comments))
+	for _, comment := range comments {
+		nodes[comment.ID] = &models.CommentThread{Comment: comment, Replies: []*models.CommentThread{}}
+	}
+
+	roots := []*models.CommentThread{}
+	for _, comment := range comments {
+		node := nodes[comment.ID]
+		if comment.ParentID == nil {
+			roots = append(roots, node)
+			continue
+		}
+		if parent, ok := nodes[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+
+	return roots
+}
+
+func subscribeCommentAdded(params graphql.ResolveParams) (interface{}, error) {
+	postId, ok := params.Args["postId"].(string)
+	if !ok || postId == "" {
+		return nil, argumentError("postId is required")
+	}
+
+	if _, err := store.GetPostByID(params.Context, postId); err != nil {
+		return nil, err
+	}
+
+	events, unsubscribe := broker.Subscribe(postId)
+	out := make(chan interface{})
+
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-params.Context.Done():
+				return
+			case comment, ok := <-events:
+				if !ok {
+					return
+				}
+				select {
+				case out <- comment:
+				case <-params.Context.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func resolveCommentAdded(params graphql.ResolveParams) (interface{}, error) {
+	comment, ok := params.Source.(*models.Comment)
+	if !ok {
+		return nil, errors.New("invalid source type")
+	}
+	return comment, nil
 }
@@ -5,19 +5,32 @@ import (
 	"errors"
 	"testing"
 
+	"ozontz/app/auth"
 	"ozontz/app/models"
+	"ozontz/app/storage"
 
 	"github.com/graphql-go/graphql"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type MockStorage struct {
-	CreatePostFn       func(ctx context.Context, post *models.Post) (*models.Post, error)
-	GetPostByIDFn      func(ctx context.Context, id string) (*models.Post, error)
-	GetPostsFn         func(ctx context.Context) ([]*models.Post, error)
-	AddCommentFn       func(ctx context.Context, comment *models.Comment) (*models.Comment, error)
-	GetLatestCommentFn func(ctx context.Context, postId string) (*models.Comment, error)
-	GetCommentsFn      func(ctx context.Context, postId string, after *string) ([]*models.Comment, error)
+	CreatePostFn         func(ctx context.Context, post *models.Post) (*models.Post, error)
+	GetPostByIDFn        func(ctx context.Context, id string) (*models.Post, error)
+	GetPostsFn           func(ctx context.Context, page storage.PageArgs) (*storage.Page[*models.Post], error)
+	AddCommentFn         func(ctx context.Context, comment *models.Comment) (*models.Comment, error)
+	GetLatestCommentFn   func(ctx context.Context, postId string) (*models.Comment, error)
+	GetLatestCommentsFn  func(ctx context.Context, postIds []string) (map[string]*models.Comment, error)
+	GetCommentsFn        func(ctx context.Context, postId string, page storage.PageArgs) (*storage.Page[*models.Comment], error)
+	GetRepliesFn         func(ctx context.Context, parentId string, page storage.PageArgs) (*storage.Page[*models.Comment], error)
+	GetCommentThreadFn   func(ctx context.Context, postId string, depth int) ([]*models.Comment, error)
+	UpdatePostFn         func(ctx context.Context, id string, title, content *string) (*models.Post, error)
+	DeletePostFn         func(ctx context.Context, id string) error
+	GetCommentByIDFn     func(ctx context.Context, id string) (*models.Comment, error)
+	UpdateCommentFn      func(ctx context.Context, id string, text string) (*models.Comment, error)
+	DeleteCommentFn      func(ctx context.Context, id string) error
+	SetCommentsAllowedFn func(ctx context.Context, postId string, allowed bool) (*models.Post, error)
+	HealthCheckFn        func(ctx context.Context) error
 }
 
 func (m *MockStorage) CreatePost(ctx context.Context, post *models.Post) (*models.Post, error) {
@@ -28,8 +41,8 @@ func (m *MockStorage) GetPostByID(ctx context.Context, id string) (*models.Post,
 	return m.GetPostByIDFn(ctx, id)
 }
 
-func (m *MockStorage) GetPosts(ctx context.Context) ([]*models.Post, error) {
-	return m.GetPostsFn(ctx)
+func (m *MockStorage) GetPosts(ctx context.Context, page storage.PageArgs) (*storage.Page[*models.Post], error) {
+	return m.GetPostsFn(ctx, page)
 }
 
 func (m *MockStorage) AddComment(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
@@ -40,8 +53,52 @@ func (m *MockStorage) GetLatestComment(ctx context.Context, postId string) (*mod
 	return m.GetLatestCommentFn(ctx, postId)
 }
 
-func (m *MockStorage) GetComments(ctx context.Context, postId string, after *string) ([]*models.Comment, error) {
-	return m.GetCommentsFn(ctx, postId, after)
+func (m *MockStorage) GetLatestComments(ctx context.Context, postIds []string) (map[string]*models.Comment, error) {
+	return m.GetLatestCommentsFn(ctx, postIds)
+}
+
+func (m *MockStorage) GetComments(ctx context.Context, postId string, page storage.PageArgs) (*storage.Page[*models.Comment], error) {
+	return m.GetCommentsFn(ctx, postId, page)
+}
+
+func (m *MockStorage) GetReplies(ctx context.Context, parentId string, page storage.PageArgs) (*storage.Page[*models.Comment], error) {
+	return m.GetRepliesFn(ctx, parentId, page)
+}
+
+func (m *MockStorage) GetCommentThread(ctx context.Context, postId string, depth int) ([]*models.Comment, error) {
+	return m.GetCommentThreadFn(ctx, postId, depth)
+}
+
+func (m *MockStorage) HealthCheck(ctx context.Context) error {
+	return m.HealthCheckFn(ctx)
+}
+
+func (m *MockStorage) UpdatePost(ctx context.Context, id string, title, content *string) (*models.Post, error) {
+	return m.UpdatePostFn(ctx, id, title, content)
+}
+
+func (m *MockStorage) DeletePost(ctx context.Context, id string) error {
+	return m.DeletePostFn(ctx, id)
+}
+
+func (m *MockStorage) GetCommentByID(ctx context.Context, id string) (*models.Comment, error) {
+	return m.GetCommentByIDFn(ctx, id)
+}
+
+func (m *MockStorage) UpdateComment(ctx context.Context, id string, text string) (*models.Comment, error) {
+	return m.UpdateCommentFn(ctx, id, text)
+}
+
+func (m *MockStorage) DeleteComment(ctx context.Context, id string) error {
+	return m.DeleteCommentFn(ctx, id)
+}
+
+func (m *MockStorage) SetCommentsAllowed(ctx context.Context, postId string, allowed bool) (*models.Post, error) {
+	return m.SetCommentsAllowedFn(ctx, postId, allowed)
+}
+
+func viewerContext(id string) context.Context {
+	return auth.WithViewer(context.Background(), &auth.Viewer{ID: id})
 }
 
 func TestResolveCreatePost(t *testing.T) {
@@ -53,10 +110,10 @@ func TestResolveCreatePost(t *testing.T) {
 	SetStore(mockStore)
 
 	params := graphql.ResolveParams{
+		Context: viewerContext("user-1"),
 		Args: map[string]interface{}{
 			"title":         "Test Post",
 			"content":       "This is a test post.",
-			"authorId":      "user-1",
 			"allowComments": true,
 		},
 	}
@@ -116,26 +173,38 @@ func TestResolveGetPost(t *testing.T) {
 
 func TestResolveGetPostsList(t *testing.T) {
 	mockStore := &MockStorage{
-		GetPostsFn: func(ctx context.Context) ([]*models.Post, error) {
-			return []*models.Post{
-				{ID: "post-1", Title: "Post 1"},
-				{ID: "post-2", Title: "Post 2"},
+		GetPostsFn: func(ctx context.Context, page storage.PageArgs) (*storage.Page[*models.Post], error) {
+			assert.Equal(t, 2, *page.First)
+			return &storage.Page[*models.Post]{
+				Items: []*models.Post{
+					{ID: "post-1", Title: "Post 1"},
+					{ID: "post-2", Title: "Post 2"},
+				},
+				HasNextPage: true,
+				TotalCount:  3,
 			}, nil
 		},
 	}
 	SetStore(mockStore)
 
-	params := graphql.ResolveParams{}
+	params := graphql.ResolveParams{
+		Args: map[string]interface{}{
+			"first": 2,
+		},
+	}
 
 	result, err := resolveGetPostsList(params)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 
-	posts, ok := result.([]*models.Post)
+	posts, ok := result.(*connection)
 	assert.True(t, ok)
-	assert.Len(t, posts, 2)
-	assert.Equal(t, "Post 1", posts[0].Title)
-	assert.Equal(t, "Post 2", posts[1].Title)
+	assert.Len(t, posts.Edges, 2)
+	assert.Equal(t, "Post 1", posts.Edges[0].Node.(*models.Post).Title)
+	assert.Equal(t, "Post 2", posts.Edges[1].Node.(*models.Post).Title)
+	assert.Equal(t, 3, posts.TotalCount)
+	assert.True(t, posts.PageInfo.HasNextPage)
+	assert.Equal(t, posts.Edges[1].Cursor, *posts.PageInfo.EndCursor)
 }
 
 func TestResolveAddComment(t *testing.T) {
@@ -147,10 +216,10 @@ func TestResolveAddComment(t *testing.T) {
 	SetStore(mockStore)
 
 	params := graphql.ResolveParams{
+		Context: viewerContext("user-1"),
 		Args: map[string]interface{}{
 			"postId":   "post-1",
 			"parentId": nil,
-			"authorId": "user-1",
 			"text":     "Test comment",
 		},
 	}
@@ -210,11 +279,14 @@ func TestResolveGetLastComment(t *testing.T) {
 
 func TestResolveGetComments(t *testing.T) {
 	mockStore := &MockStorage{
-		GetCommentsFn: func(ctx context.Context, postId string, after *string) ([]*models.Comment, error) {
+		GetCommentsFn: func(ctx context.Context, postId string, page storage.PageArgs) (*storage.Page[*models.Comment], error) {
 			if postId == "post-1" {
-				return []*models.Comment{
-					{ID: "com-1", Text: "Comment 1"},
-					{ID: "com-2", Text: "Comment 2"},
+				return &storage.Page[*models.Comment]{
+					Items: []*models.Comment{
+						{ID: "com-1", Text: "Comment 1"},
+						{ID: "com-2", Text: "Comment 2"},
+					},
+					TotalCount: 2,
 				}, nil
 			}
 			return nil, errors.New("no comments found")
@@ -233,11 +305,12 @@ func TestResolveGetComments(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 
-		comments, ok := result.([]*models.Comment)
+		comments, ok := result.(*connection)
 		assert.True(t, ok)
-		assert.Len(t, comments, 2)
-		assert.Equal(t, "Comment 1", comments[0].Text)
-		assert.Equal(t, "Comment 2", comments[1].Text)
+		assert.Len(t, comments.Edges, 2)
+		assert.Equal(t, "Comment 1", comments.Edges[0].Node.(*models.Comment).Text)
+		assert.Equal(t, "Comment 2", comments.Edges[1].Node.(*models.Comment).Text)
+		assert.False(t, comments.PageInfo.HasNextPage)
 	})
 
 	t.Run("Invalid Post ID", func(t *testing.T) {
@@ -252,3 +325,265 @@ func TestResolveGetComments(t *testing.T) {
 		assert.Nil(t, result)
 	})
 }
+
+func TestResolveGetReplies(t *testing.T) {
+	mockStore := &MockStorage{
+		GetRepliesFn: func(ctx context.Context, parentId string, page storage.PageArgs) (*storage.Page[*models.Comment], error) {
+			assert.Equal(t, "com-1", parentId)
+			assert.Equal(t, 2, *page.First)
+			return &storage.Page[*models.Comment]{
+				Items:      []*models.Comment{{ID: "com-2", ParentID: &parentId}},
+				TotalCount: 1,
+			}, nil
+		},
+	}
+	SetStore(mockStore)
+
+	params := graphql.ResolveParams{
+		Source: &models.Comment{ID: "com-1"},
+		Args: map[string]interface{}{
+			"first": 2,
+		},
+	}
+
+	result, err := resolveGetReplies(params)
+	assert.NoError(t, err)
+
+	replies, ok := result.(*connection)
+	assert.True(t, ok)
+	assert.Len(t, replies.Edges, 1)
+	assert.Equal(t, "com-2", replies.Edges[0].Node.(*models.Comment).ID)
+}
+
+func TestResolveGetCommentThread(t *testing.T) {
+	root, child := "com-1", "com-2"
+	mockStore := &MockStorage{
+		GetCommentThreadFn: func(ctx context.Context, postId string, depth int) ([]*models.Comment, error) {
+			assert.Equal(t, 3, depth)
+			return []*models.Comment{
+				{ID: root},
+				{ID: child, ParentID: &root},
+				{ID: "com-3", ParentID: &child},
+				{ID: "com-4"},
+			}, nil
+		},
+	}
+	SetStore(mockStore)
+
+	params := graphql.ResolveParams{
+		Args: map[string]interface{}{
+			"postId": "post-1",
+			"depth":  3,
+		},
+	}
+
+	result, err := resolveGetCommentThread(params)
+	assert.NoError(t, err)
+
+	thread, ok := result.([]*models.CommentThread)
+	assert.True(t, ok)
+	assert.Len(t, thread, 2)
+	assert.Equal(t, "com-1", thread[0].Comment.ID)
+	assert.Len(t, thread[0].Replies, 1)
+	assert.Equal(t, "com-2", thread[0].Replies[0].Comment.ID)
+	assert.Equal(t, "com-3", thread[0].Replies[0].Replies[0].Comment.ID)
+	assert.Equal(t, "com-4", thread[1].Comment.ID)
+	assert.Empty(t, thread[1].Replies)
+}
+
+func TestResolveUpdatePost(t *testing.T) {
+	mockStore := &MockStorage{
+		GetPostByIDFn: func(ctx context.Context, id string) (*models.Post, error) {
+			return &models.Post{ID: id, Title: "Old title", Content: "Old content", AuthorID: "user-1"}, nil
+		},
+		UpdatePostFn: func(ctx context.Context, id string, title, content *string) (*models.Post, error) {
+			assert.Nil(t, content)
+			return &models.Post{ID: id, Title: *title, Content: "Old content", AuthorID: "user-1"}, nil
+		},
+	}
+	SetStore(mockStore)
+
+	t.Run("Author", func(t *testing.T) {
+		params := graphql.ResolveParams{
+			Context: viewerContext("user-1"),
+			Args: map[string]interface{}{
+				"id":    "post-1",
+				"title": "New title",
+			},
+		}
+
+		result, err := resolveUpdatePost(params)
+		assert.NoError(t, err)
+
+		post, ok := result.(*models.Post)
+		assert.True(t, ok)
+		assert.Equal(t, "New title", post.Title)
+		assert.Equal(t, "Old content", post.Content)
+	})
+
+	t.Run("Not author", func(t *testing.T) {
+		params := graphql.ResolveParams{
+			Context: viewerContext("user-2"),
+			Args: map[string]interface{}{
+				"id":    "post-1",
+				"title": "New title",
+			},
+		}
+
+		result, err := resolveUpdatePost(params)
+		assert.ErrorIs(t, err, errNotAuthor)
+		assert.Nil(t, result)
+	})
+}
+
+func TestResolveDeleteComment(t *testing.T) {
+	var deleted []string
+	mockStore := &MockStorage{
+		GetCommentByIDFn: func(ctx context.Context, id string) (*models.Comment, error) {
+			return &models.Comment{ID: id, AuthorID: "user-1"}, nil
+		},
+		DeleteCommentFn: func(ctx context.Context, id string) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+	SetStore(mockStore)
+
+	result, err := resolveDeleteComment(graphql.ResolveParams{
+		Context: viewerContext("user-2"),
+		Args:    map[string]interface{}{"id": "com-1"},
+	})
+	assert.ErrorIs(t, err, errNotAuthor)
+	assert.Nil(t, result)
+	assert.Empty(t, deleted)
+
+	result, err = resolveDeleteComment(graphql.ResolveParams{
+		Context: viewerContext("user-1"),
+		Args:    map[string]interface{}{"id": "com-1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, true, result)
+	assert.Equal(t, []string{"com-1"}, deleted)
+}
+
+func TestResolveSetCommentsAllowed(t *testing.T) {
+	mockStore := &MockStorage{
+		GetPostByIDFn: func(ctx context.Context, id string) (*models.Post, error) {
+			return &models.Post{ID: id, AuthorID: "user-1", AllowComments: true}, nil
+		},
+		SetCommentsAllowedFn: func(ctx context.Context, postId string, allowed bool) (*models.Post, error) {
+			return &models.Post{ID: postId, AuthorID: "user-1", AllowComments: allowed}, nil
+		},
+	}
+	SetStore(mockStore)
+
+	t.Run("Author", func(t *testing.T) {
+		params := graphql.ResolveParams{
+			Context: viewerContext("user-1"),
+			Args: map[string]interface{}{
+				"postId":  "post-1",
+				"allowed": false,
+			},
+		}
+
+		result, err := resolveSetCommentsAllowed(params)
+		assert.NoError(t, err)
+
+		post, ok := result.(*models.Post)
+		assert.True(t, ok)
+		assert.False(t, post.AllowComments)
+	})
+
+	t.Run("Not author", func(t *testing.T) {
+		params := graphql.ResolveParams{
+			Context: viewerContext("user-2"),
+			Args: map[string]interface{}{
+				"postId":  "post-1",
+				"allowed": false,
+			},
+		}
+
+		result, err := resolveSetCommentsAllowed(params)
+		assert.ErrorIs(t, err, errNotAuthor)
+		assert.Nil(t, result)
+	})
+
+	t.Run("Author is not taken from arguments", func(t *testing.T) {
+		schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: QueryType, Mutation: MutationType})
+		require.NoError(t, err)
+
+		result := graphql.Do(graphql.Params{
+			Schema:        schema,
+			Context:       viewerContext("user-2"),
+			RequestString: `mutation { setCommentsAllowed(postId: "post-1", authorId: "user-1", allowed: false) { id } }`,
+		})
+		require.Len(t, result.Errors, 1)
+		assert.Contains(t, result.Errors[0].Message, `Unknown argument "authorId"`)
+	})
+}
+
+func TestResolveAddCommentCommentsDisabled(t *testing.T) {
+	mockStore := &MockStorage{
+		AddCommentFn: func(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
+			return nil, storage.ErrCommentsDisabled
+		},
+	}
+	SetStore(mockStore)
+
+	params := graphql.ResolveParams{
+		Context: viewerContext("user-1"),
+		Args: map[string]interface{}{
+			"postId": "post-1",
+			"text":   "Test comment",
+		},
+	}
+
+	result, err := resolveAddComment(params)
+	assert.ErrorIs(t, err, storage.ErrCommentsDisabled)
+	assert.Nil(t, result)
+}
+
+func TestMutationsRequireViewer(t *testing.T) {
+	mockStore := &MockStorage{
+		CreatePostFn: func(ctx context.Context, post *models.Post) (*models.Post, error) {
+			t.Fatal("CreatePost must not be called without a viewer")
+			return nil, nil
+		},
+		AddCommentFn: func(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
+			t.Fatal("AddComment must not be called without a viewer")
+			return nil, nil
+		},
+	}
+	SetStore(mockStore)
+
+	result, err := resolveCreatePost(graphql.ResolveParams{
+		Context: context.Background(),
+		Args: map[string]interface{}{
+			"title":         "Test Post",
+			"content":       "This is a test post.",
+			"allowComments": true,
+		},
+	})
+	assert.ErrorIs(t, err, errUnauthenticated)
+	assert.Nil(t, result)
+
+	result, err = resolveAddComment(graphql.ResolveParams{
+		Context: context.Background(),
+		Args: map[string]interface{}{
+			"postId": "post-1",
+			"text":   "Test comment",
+		},
+	})
+	assert.ErrorIs(t, err, errUnauthenticated)
+	assert.Nil(t, result)
+}
+
+func TestResolveViewer(t *testing.T) {
+	result, err := resolveViewer(graphql.ResolveParams{Context: viewerContext("user-1")})
+	assert.NoError(t, err)
+	assert.Equal(t, &auth.Viewer{ID: "user-1"}, result)
+
+	result, err = resolveViewer(graphql.ResolveParams{Context: context.Background()})
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
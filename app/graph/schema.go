@@ -13,9 +13,10 @@ var postType = graphql.NewObject(graphql.ObjectConfig{
 		"authorId":      &graphql.Field{Type: graphql.String},
 		"allowComments": &graphql.Field{Type: graphql.Boolean},
 		"createdAt":     &graphql.Field{Type: graphql.String},
+		"updatedAt":     &graphql.Field{Type: graphql.String},
 		"lastComment": &graphql.Field{
 			Type:    commentType,
-			Resolve: resolveGetLastComment,
+			Resolve: traced(resolveGetLastComment),
 		},
 	},
 })
@@ -28,31 +29,111 @@ var commentType = graphql.NewObject(graphql.ObjectConfig{
 		"parentId":  &graphql.Field{Type: graphql.String},
 		"authorId":  &graphql.Field{Type: graphql.String},
 		"text":      &graphql.Field{Type: graphql.String},
+		"deleted":   &graphql.Field{Type: graphql.Boolean},
 		"createdAt": &graphql.Field{Type: graphql.String},
+		"updatedAt": &graphql.Field{Type: graphql.String},
 	},
 })
 
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"startCursor":     &graphql.Field{Type: graphql.String},
+		"endCursor":       &graphql.Field{Type: graphql.String},
+	},
+})
+
+var postConnectionType = newConnectionType("Post", postType)
+
+var commentConnectionType = newConnectionType("Comment", commentType)
+
+func newConnectionType(name string, nodeType *graphql.Object) *graphql.Object {
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Edge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: nodeType},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Connection",
+		Fields: graphql.Fields{
+			"edges":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType)))},
+			"pageInfo":   &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+			"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+}
+
+func connectionArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args["first"] = &graphql.ArgumentConfig{Type: graphql.Int}
+	args["after"] = &graphql.ArgumentConfig{Type: graphql.String}
+	args["last"] = &graphql.ArgumentConfig{Type: graphql.Int}
+	args["before"] = &graphql.ArgumentConfig{Type: graphql.String}
+	return args
+}
+
+var viewerType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Viewer",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var commentThreadType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CommentThread",
+	Fields: graphql.Fields{
+		"comment": &graphql.Field{Type: commentType},
+	},
+})
+
+func init() {
+	commentType.AddFieldConfig("replies", &graphql.Field{
+		Type:    graphql.NewNonNull(commentConnectionType),
+		Args:    connectionArgs(graphql.FieldConfigArgument{}),
+		Resolve: traced(resolveGetReplies),
+	})
+	commentThreadType.AddFieldConfig("replies", &graphql.Field{
+		Type: graphql.NewList(commentThreadType),
+	})
+}
+
 var QueryType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "Query",
 	Fields: graphql.Fields{
 		"posts": &graphql.Field{
-			Type:    graphql.NewList(postType),
-			Resolve: resolveGetPostsList,
+			Type:    graphql.NewNonNull(postConnectionType),
+			Args:    connectionArgs(graphql.FieldConfigArgument{}),
+			Resolve: traced(resolveGetPostsList),
 		},
 		"post": &graphql.Field{
 			Type: postType,
 			Args: graphql.FieldConfigArgument{
 				"id": &graphql.ArgumentConfig{Type: graphql.String},
 			},
-			Resolve: resolveGetPost,
+			Resolve: traced(resolveGetPost),
 		},
 		"comments": &graphql.Field{
-			Type: graphql.NewList(commentType),
+			Type: graphql.NewNonNull(commentConnectionType),
+			Args: connectionArgs(graphql.FieldConfigArgument{
+				"postId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			}),
+			Resolve: traced(resolveGetComments),
+		},
+		"commentThread": &graphql.Field{
+			Type: graphql.NewList(commentThreadType),
 			Args: graphql.FieldConfigArgument{
 				"postId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"after":  &graphql.ArgumentConfig{Type: graphql.String},
+				"depth":  &graphql.ArgumentConfig{Type: graphql.Int},
 			},
-			Resolve: resolveGetComments,
+			Resolve: traced(resolveGetCommentThread),
+		},
+		"viewer": &graphql.Field{
+			Type:    viewerType,
+			Resolve: traced(resolveViewer),
 		},
 	},
 })
@@ -65,20 +146,71 @@ var MutationType = graphql.NewObject(graphql.ObjectConfig{
 			Args: graphql.FieldConfigArgument{
 				"title":         &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 				"content":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"authorId":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 				"allowComments": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Boolean)},
 			},
-			Resolve: resolveCreatePost,
+			Resolve: traced(resolveCreatePost),
 		},
 		"addComment": &graphql.Field{
 			Type: commentType,
 			Args: graphql.FieldConfigArgument{
 				"postId":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 				"parentId": &graphql.ArgumentConfig{Type: graphql.String},
-				"authorId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 				"text":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 			},
-			Resolve: resolveAddComment,
+			Resolve: traced(resolveAddComment),
+		},
+		"updatePost": &graphql.Field{
+			Type: postType,
+			Args: graphql.FieldConfigArgument{
+				"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"title":   &graphql.ArgumentConfig{Type: graphql.String},
+				"content": &graphql.ArgumentConfig{Type: graphql.String},
+			},
+			Resolve: traced(resolveUpdatePost),
+		},
+		"setCommentsAllowed": &graphql.Field{
+			Type: postType,
+			Args: graphql.FieldConfigArgument{
+				"postId":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"allowed": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Boolean)},
+			},
+			Resolve: traced(resolveSetCommentsAllowed),
+		},
+		"deletePost": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: traced(resolveDeletePost),
+		},
+		"updateComment": &graphql.Field{
+			Type: commentType,
+			Args: graphql.FieldConfigArgument{
+				"id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"text": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: traced(resolveUpdateComment),
+		},
+		"deleteComment": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: traced(resolveDeleteComment),
+		},
+	},
+})
+
+var SubscriptionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Subscription",
+	Fields: graphql.Fields{
+		"commentAdded": &graphql.Field{
+			Type: commentType,
+			Args: graphql.FieldConfigArgument{
+				"postId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Subscribe: subscribeCommentAdded,
+			Resolve:   resolveCommentAdded,
 		},
 	},
 })
@@ -0,0 +1,22 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RequestTimeout bounds the context handed to resolvers, so storage calls of
+// a slow request are cancelled once the deadline passes. A non-positive
+// timeout disables it.
+func RequestTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ozontz/app/models"
+	"ozontz/app/storage"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingStore returns a store whose GetPosts waits for its context to end
+// and reports the context error it observed.
+func blockingStore(observed chan<- error) *MockStorage {
+	return &MockStorage{
+		GetPostsFn: func(ctx context.Context, page storage.PageArgs) (*storage.Page[*models.Post], error) {
+			select {
+			case <-ctx.Done():
+				observed <- ctx.Err()
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+				observed <- nil
+				return &storage.Page[*models.Post]{}, nil
+			}
+		},
+	}
+}
+
+func newQueryRequest(ctx context.Context) *http.Request {
+	body := bytes.NewBufferString(`{"query": "{ posts { totalCount } }"}`)
+	return httptest.NewRequest(http.MethodPost, "/query", body).WithContext(ctx)
+}
+
+func TestRequestTimeoutCancelsStorage(t *testing.T) {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: QueryType, Mutation: MutationType})
+	require.NoError(t, err)
+
+	observed := make(chan error, 1)
+	SetStore(blockingStore(observed))
+
+	handler := RequestTimeout(50*time.Millisecond, GraphQLHandler(&schema))
+
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), newQueryRequest(context.Background()))
+
+	assert.ErrorIs(t, <-observed, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestClientDisconnectCancelsStorage(t *testing.T) {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: QueryType, Mutation: MutationType})
+	require.NoError(t, err)
+
+	observed := make(chan error, 1)
+	SetStore(blockingStore(observed))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	GraphQLHandler(&schema).ServeHTTP(httptest.NewRecorder(), newQueryRequest(ctx))
+
+	assert.ErrorIs(t, <-observed, context.Canceled)
+}
+
+func TestRequestTimeoutDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		assert.False(t, ok)
+	})
+
+	RequestTimeout(0, next).ServeHTTP(httptest.NewRecorder(), newQueryRequest(context.Background()))
+}
@@ -0,0 +1,121 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/printer"
+	"github.com/graphql-go/graphql/language/visitor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("ozontz/app/graph")
+
+// startOperation starts the span of a GraphQL operation. It is named once
+// the document is resolved, see endOperation.
+func startOperation(ctx context.Context) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "graphql", trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// endOperation ends the span of an operation and echoes its trace ID in the
+// response extensions, so that clients can report it along with errors.
+func endOperation(span trace.Span, op *ast.OperationDefinition, params graphQLRequest, response graphQLResponse) graphQLResponse {
+	defer span.End()
+
+	name := params.OperationName
+	if op != nil {
+		if op.Name != nil {
+			name = op.Name.Value
+		}
+		if name != "" {
+			span.SetName(op.Operation + " " + name)
+		} else {
+			span.SetName(op.Operation)
+		}
+		span.SetAttributes(attribute.String(string(semconv.GraphqlOperationTypeKey), op.Operation))
+	}
+	span.SetAttributes(semconv.GraphqlOperationName(name))
+	if document := redactedDocument(params.Query); document != "" {
+		span.SetAttributes(semconv.GraphqlDocument(document))
+	}
+	if len(response.Errors) > 0 {
+		span.SetStatus(codes.Error, response.Errors[0].Message)
+	}
+
+	spanContext := span.SpanContext()
+	if !spanContext.HasTraceID() {
+		return response
+	}
+	extensions := make(map[string]interface{}, len(response.Extensions)+1)
+	for key, value := range response.Extensions {
+		extensions[key] = value
+	}
+	extensions["traceId"] = spanContext.TraceID().String()
+	response.Extensions = extensions
+	return response
+}
+
+// redactedDocument returns the document with string and number literals
+// replaced by placeholders, as arguments may hold comment text and other user
+// content. It is empty when the document doesn't parse.
+func redactedDocument(query string) string {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return ""
+	}
+
+	visitor.Visit(doc, &visitor.VisitorOptions{
+		Enter: func(p visitor.VisitFuncParams) (string, interface{}) {
+			switch value := p.Node.(type) {
+			case *ast.StringValue:
+				value.Value = "?"
+			case *ast.IntValue:
+				value.Value = "0"
+			case *ast.FloatValue:
+				value.Value = "0.0"
+			}
+			return visitor.ActionNoChange, nil
+		},
+	}, nil)
+
+	document, _ := printer.Print(doc).(string)
+	return document
+}
+
+// traced wraps a resolver in a span named after the field. Spans of
+// resolvers that return a thunk end once the thunk has run.
+func traced(resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		ctx := p.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx, span := tracer.Start(ctx, p.Info.ParentType.Name()+"."+p.Info.FieldName)
+		p.Context = ctx
+
+		result, err := resolve(p)
+		if thunk, ok := result.(func() (interface{}, error)); ok && err == nil {
+			return func() (interface{}, error) {
+				result, err := thunk()
+				endResolver(span, err)
+				return result, err
+			}, nil
+		}
+		endResolver(span, err)
+		return result, err
+	}
+}
+
+func endResolver(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
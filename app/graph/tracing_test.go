@@ -0,0 +1,101 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ozontz/app/models"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func withSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	t.Cleanup(func() { tracer = previous })
+	return recorder
+}
+
+func spanNames(spans []sdktrace.ReadOnlySpan) []string {
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	return names
+}
+
+// traceID returns the trace ID a response echoes in its extensions.
+func traceID(t *testing.T, rr *httptest.ResponseRecorder) interface{} {
+	t.Helper()
+	var resp struct {
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	return resp.Extensions["traceId"]
+}
+
+func TestOperationSpans(t *testing.T) {
+	recorder := withSpanRecorder(t)
+	SetStore(newCountingStore([]*models.Post{{ID: "post-1", AllowComments: true}}, nil))
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: QueryType, Mutation: MutationType})
+	require.NoError(t, err)
+
+	body := bytes.NewBufferString(`{"query": "query Feed { posts { edges { node { id lastComment { id } } } } }"}`)
+	rr := httptest.NewRecorder()
+	GraphQLHandler(&schema).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/query", body))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	spans := recorder.Ended()
+	assert.ElementsMatch(t, []string{"query Feed", "Query.posts", "Post.lastComment"}, spanNames(spans))
+
+	var operation sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == "query Feed" {
+			operation = span
+		}
+	}
+	require.NotNil(t, operation)
+	for _, span := range spans {
+		assert.Equal(t, operation.SpanContext().TraceID(), span.SpanContext().TraceID())
+		if span != operation {
+			assert.Equal(t, operation.SpanContext().SpanID(), span.Parent().SpanID(), "resolver spans are children of the operation")
+		}
+	}
+
+	assert.Empty(t, decodeResponse(t, rr).Errors)
+	assert.Equal(t, operation.SpanContext().TraceID().String(), traceID(t, rr))
+}
+
+func TestOperationSpanRecordsErrors(t *testing.T) {
+	recorder := withSpanRecorder(t)
+
+	rr := httptest.NewRecorder()
+	GraphQLHandler(&mockSchema).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query": "{ missing }"}`)))
+	require.Len(t, decodeResponse(t, rr).Errors, 1)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "query", spans[0].Name(), "anonymous operations are named after their type")
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, spans[0].SpanContext().TraceID().String(), traceID(t, rr))
+}
+
+func TestRedactedDocument(t *testing.T) {
+	document := redactedDocument(`mutation { addComment(postId: "post-1", text: "secret", limit: 3, score: 1.5, draft: true) { id } }`)
+	assert.NotContains(t, document, "secret")
+	assert.NotContains(t, document, "post-1")
+	assert.Contains(t, document, `addComment(postId: "?", text: "?", limit: 0, score: 0.0, draft: true)`)
+
+	assert.Empty(t, redactedDocument("{ posts"))
+}
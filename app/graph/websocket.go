@@ -0,0 +1,311 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Message types and close codes of the graphql-transport-ws protocol:
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const (
+	wsProtocol = "graphql-transport-ws"
+
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+
+	closeBadRequest      = 4400
+	closeUnauthorized    = 4401
+	closeInitTimeout     = 4408
+	closeSubscriberExist = 4409
+	closeTooManyInit     = 4429
+
+	connectionInitTimeout = 10 * time.Second
+)
+
+var (
+	// maxMessageSize is the largest message, in bytes, a client may send.
+	maxMessageSize = 64 << 10
+	// maxSubscriptions is the number of operations a connection may run at
+	// once.
+	maxSubscriptions = 100
+)
+
+var errMessageTooLarge = errors.New("message too large")
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type wsSubscribePayload struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    requestExtensions      `json:"extensions"`
+}
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{wsProtocol},
+}
+
+type wsConnection struct {
+	conn   *websocket.Conn
+	schema *graphql.Schema
+
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	acknowledged  bool
+	subscriptions map[string]context.CancelFunc
+}
+
+func SubscriptionHandler(schema *graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			slog.WarnContext(r.Context(), "WebSocket upgrade failed", "error", err)
+			return
+		}
+		defer conn.Close()
+
+		if conn.Subprotocol() != wsProtocol {
+			closeConnection(conn, websocket.CloseProtocolError, "Unsupported subprotocol")
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		c := &wsConnection{
+			conn:          conn,
+			schema:        schema,
+			subscriptions: make(map[string]context.CancelFunc),
+		}
+		c.serve(ctx)
+	}
+}
+
+func (c *wsConnection) serve(ctx context.Context) {
+	initTimer := time.AfterFunc(connectionInitTimeout, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.acknowledged {
+			closeConnection(c.conn, closeInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	for {
+		msg, err := c.read()
+		if err != nil {
+			if errors.Is(err, errMessageTooLarge) {
+				closeConnection(c.conn, closeBadRequest, "Message too large")
+			} else if _, ok := err.(*json.SyntaxError); ok {
+				closeConnection(c.conn, closeBadRequest, "Invalid message received")
+			}
+			return
+		}
+
+		switch msg.Type {
+		case msgConnectionInit:
+			c.mu.Lock()
+			if c.acknowledged {
+				c.mu.Unlock()
+				closeConnection(c.conn, closeTooManyInit, "Too many initialisation requests")
+				return
+			}
+			c.acknowledged = true
+			c.mu.Unlock()
+			c.write(wsMessage{Type: msgConnectionAck})
+
+		case msgPing:
+			c.write(wsMessage{Type: msgPong})
+
+		case msgPong:
+
+		case msgSubscribe:
+			if !c.startSubscription(ctx, msg) {
+				return
+			}
+
+		case msgComplete:
+			c.stopSubscription(msg.ID)
+
+		default:
+			closeConnection(c.conn, closeBadRequest, fmt.Sprintf("Invalid message type %q", msg.Type))
+			return
+		}
+	}
+}
+
+// read decodes the next message. The size is checked here rather than with
+// SetReadLimit, which closes the connection with 1009 instead of the 4400 the
+// protocol asks for.
+func (c *wsConnection) read() (wsMessage, error) {
+	var msg wsMessage
+	_, r, err := c.conn.NextReader()
+	if err != nil {
+		return msg, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxMessageSize)+1))
+	if err != nil {
+		return msg, err
+	}
+	if len(data) > maxMessageSize {
+		return msg, errMessageTooLarge
+	}
+	return msg, json.Unmarshal(data, &msg)
+}
+
+func (c *wsConnection) startSubscription(ctx context.Context, msg wsMessage) bool {
+	if msg.ID == "" {
+		closeConnection(c.conn, closeBadRequest, "Subscribe message requires an id")
+		return false
+	}
+
+	var payload wsSubscribePayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		closeConnection(c.conn, closeBadRequest, "Invalid subscribe payload")
+		return false
+	}
+
+	c.mu.Lock()
+	if !c.acknowledged {
+		c.mu.Unlock()
+		closeConnection(c.conn, closeUnauthorized, "Unauthorized")
+		return false
+	}
+	if _, exists := c.subscriptions[msg.ID]; exists {
+		c.mu.Unlock()
+		closeConnection(c.conn, closeSubscriberExist, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+		return false
+	}
+	if len(c.subscriptions) >= maxSubscriptions {
+		c.mu.Unlock()
+		closeConnection(c.conn, closeBadRequest, "Too many subscriptions")
+		return false
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	c.subscriptions[msg.ID] = cancel
+	c.mu.Unlock()
+
+	params := graphql.Params{
+		Context:        subCtx,
+		Schema:         *c.schema,
+		RequestString:  payload.Query,
+		OperationName:  payload.OperationName,
+		VariableValues: payload.Variables,
+	}
+
+	go func() {
+		defer c.finishSubscription(msg.ID)
+
+		query, register, reqError := resolvePersistedQuery(subCtx, payload.Query, payload.Extensions.PersistedQuery)
+		if reqError == nil {
+			var complexity *queryComplexity
+			complexity, reqError = checkQuery(query, payload.OperationName, payload.Variables)
+			if register && complexity != nil && reqError == nil {
+				registerPersistedQuery(subCtx, query)
+			}
+		}
+		if reqError != nil {
+			errorsPayload, _ := json.Marshal([]gqlerrors.FormattedError{reqError.formatted()})
+			c.write(wsMessage{ID: msg.ID, Type: msgError, Payload: errorsPayload})
+			return
+		}
+		params.RequestString = query
+
+		var results chan *graphql.Result
+		if isSubscription(query, payload.OperationName) {
+			results = graphql.Subscribe(params)
+		} else {
+			// Only one-off operations get a loader: the events of a
+			// subscription must not see comments cached for earlier ones.
+			params.Context = withLatestCommentLoader(subCtx)
+			results = make(chan *graphql.Result, 1)
+			results <- graphql.Do(params)
+			close(results)
+		}
+
+		first := true
+		for result := range results {
+			result.Errors = withErrorCodes(subCtx, result.Errors)
+			if first && result.Data == nil && len(result.Errors) > 0 {
+				errorsPayload, _ := json.Marshal(result.Errors)
+				c.write(wsMessage{ID: msg.ID, Type: msgError, Payload: errorsPayload})
+				return
+			}
+			first = false
+
+			resultPayload, err := json.Marshal(result)
+			if err != nil {
+				slog.ErrorContext(subCtx, "Failed to marshal subscription result", "error", err)
+				continue
+			}
+			c.write(wsMessage{ID: msg.ID, Type: msgNext, Payload: resultPayload})
+		}
+
+		if subCtx.Err() == nil {
+			c.write(wsMessage{ID: msg.ID, Type: msgComplete})
+		}
+	}()
+
+	return true
+}
+
+func (c *wsConnection) stopSubscription(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cancel, ok := c.subscriptions[id]; ok {
+		cancel()
+	}
+}
+
+func (c *wsConnection) finishSubscription(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cancel, ok := c.subscriptions[id]; ok {
+		cancel()
+		delete(c.subscriptions, id)
+	}
+}
+
+func (c *wsConnection) write(msg wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.conn.WriteJSON(msg); err != nil {
+		slog.Warn("Failed to write WebSocket message", "error", err)
+	}
+}
+
+func closeConnection(conn *websocket.Conn, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	conn.Close()
+}
+
+func isSubscription(query, operationName string) bool {
+	return operationType(query, operationName) == ast.OperationTypeSubscription
+}
@@ -0,0 +1,170 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ozontz/app/models"
+	"ozontz/app/pubsub"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialSubscriptions(t *testing.T) *websocket.Conn {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:        QueryType,
+		Mutation:     MutationType,
+		Subscription: SubscriptionType,
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(SubscriptionHandler(&schema))
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{wsProtocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg wsMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+type notifyingBroker struct {
+	*pubsub.Hub
+	subscribed chan struct{}
+}
+
+func (b *notifyingBroker) Subscribe(postId string) (<-chan *models.Comment, func()) {
+	events, unsubscribe := b.Hub.Subscribe(postId)
+	b.subscribed <- struct{}{}
+	return events, unsubscribe
+}
+
+func TestSubscriptionCommentAdded(t *testing.T) {
+	subscribed := make(chan struct{}, 1)
+	SetBroker(&notifyingBroker{Hub: pubsub.NewHub(), subscribed: subscribed})
+	SetStore(&MockStorage{
+		GetPostByIDFn: func(ctx context.Context, id string) (*models.Post, error) {
+			if id == "post-1" {
+				return &models.Post{ID: "post-1", AllowComments: true}, nil
+			}
+			return nil, errors.New("post not found")
+		},
+		AddCommentFn: func(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
+			comment.ID = "com-1"
+			return comment, nil
+		},
+	})
+
+	conn := dialSubscriptions(t)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: msgConnectionInit}))
+	assert.Equal(t, msgConnectionAck, readMessage(t, conn).Type)
+
+	payload := `{"query": "subscription { commentAdded(postId: \"post-1\") { id text } }"}`
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: msgSubscribe, Payload: json.RawMessage(payload)}))
+
+	select {
+	case <-subscribed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscription was not registered")
+	}
+
+	_, err := resolveAddComment(graphql.ResolveParams{
+		Context: viewerContext("user-1"),
+		Args: map[string]interface{}{
+			"postId": "post-1",
+			"text":   "Hello",
+		},
+	})
+	require.NoError(t, err)
+
+	msg := readMessage(t, conn)
+	assert.Equal(t, msgNext, msg.Type)
+	assert.Equal(t, "1", msg.ID)
+
+	var result struct {
+		Data struct {
+			CommentAdded models.Comment `json:"commentAdded"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Payload, &result))
+	assert.Equal(t, "com-1", result.Data.CommentAdded.ID)
+	assert.Equal(t, "Hello", result.Data.CommentAdded.Text)
+}
+
+func TestSubscriptionRequiresConnectionInit(t *testing.T) {
+	conn := dialSubscriptions(t)
+
+	payload := `{"query": "subscription { commentAdded(postId: \"post-1\") { id } }"}`
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: msgSubscribe, Payload: json.RawMessage(payload)}))
+
+	assert.Equal(t, closeUnauthorized, readCloseCode(t, conn))
+}
+
+func readCloseCode(t *testing.T, conn *websocket.Conn) int {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	return closeErr.Code
+}
+
+func TestSubscriptionMessageTooLarge(t *testing.T) {
+	conn := dialSubscriptions(t)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: msgConnectionInit}))
+	assert.Equal(t, msgConnectionAck, readMessage(t, conn).Type)
+
+	payload := `{"query": "` + strings.Repeat(" ", maxMessageSize) + `{ posts { totalCount } }"}`
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: msgSubscribe, Payload: json.RawMessage(payload)}))
+
+	assert.Equal(t, closeBadRequest, readCloseCode(t, conn))
+}
+
+func TestSubscriptionLimit(t *testing.T) {
+	defer func(limit int) { maxSubscriptions = limit }(maxSubscriptions)
+	maxSubscriptions = 2
+
+	subscribed := make(chan struct{}, maxSubscriptions)
+	SetBroker(&notifyingBroker{Hub: pubsub.NewHub(), subscribed: subscribed})
+	SetStore(&MockStorage{
+		GetPostByIDFn: func(ctx context.Context, id string) (*models.Post, error) {
+			return &models.Post{ID: id, AllowComments: true}, nil
+		},
+	})
+
+	conn := dialSubscriptions(t)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: msgConnectionInit}))
+	assert.Equal(t, msgConnectionAck, readMessage(t, conn).Type)
+
+	payload := `{"query": "subscription { commentAdded(postId: \"post-1\") { id } }"}`
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, conn.WriteJSON(wsMessage{ID: id, Type: msgSubscribe, Payload: json.RawMessage(payload)}))
+	}
+
+	assert.Equal(t, closeBadRequest, readCloseCode(t, conn))
+	for i := 0; i < maxSubscriptions; i++ {
+		select {
+		case <-subscribed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Subscription was not started")
+		}
+	}
+}
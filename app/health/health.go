@@ -0,0 +1,78 @@
+// Package health serves the liveness and readiness probes of the service.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout bounds a readiness check, so that a hanging database makes
+// the probe fail instead of piling up requests.
+const DefaultTimeout = 2 * time.Second
+
+// Checker reports the service ready while its check passes and it is not
+// shutting down.
+type Checker struct {
+	check        func(ctx context.Context) error
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+// NewChecker returns a Checker running check on every readiness probe. A
+// non-positive timeout means DefaultTimeout.
+func NewChecker(check func(ctx context.Context) error, timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{check: check, timeout: timeout}
+}
+
+// Shutdown makes readiness probes fail, so that load balancers stop sending
+// new requests while in-flight ones are drained.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+type status struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Liveness answers as long as the process serves HTTP; it checks no
+// dependencies, so a database outage doesn't get the service restarted.
+func (c *Checker) Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK, status{Status: "ok"})
+	}
+}
+
+// Readiness answers 503 while the service is shutting down or its check
+// fails. Failure details are logged, not returned.
+func (c *Checker) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.shuttingDown.Load() {
+			writeStatus(w, http.StatusServiceUnavailable, status{Status: "unavailable", Reason: "shutting down"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
+		defer cancel()
+		if err := c.check(ctx); err != nil {
+			slog.WarnContext(ctx, "Readiness check failed", "error", err)
+			writeStatus(w, http.StatusServiceUnavailable, status{Status: "unavailable", Reason: "storage unavailable"})
+			return
+		}
+		writeStatus(w, http.StatusOK, status{Status: "ok"})
+	}
+}
+
+func writeStatus(w http.ResponseWriter, code int, body status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
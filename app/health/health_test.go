@@ -0,0 +1,51 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func probe(handler http.Handler) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return rr
+}
+
+func TestReadiness(t *testing.T) {
+	var checkErr error
+	checker := NewChecker(func(ctx context.Context) error { return checkErr }, 0)
+
+	rr := probe(checker.Readiness())
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, rr.Body.String())
+
+	checkErr = errors.New("connection refused")
+	rr = probe(checker.Readiness())
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"status": "unavailable", "reason": "storage unavailable"}`, rr.Body.String())
+	assert.Equal(t, http.StatusOK, probe(checker.Liveness()).Code, "liveness does not depend on storage")
+
+	checkErr = nil
+	checker.Shutdown()
+	rr = probe(checker.Readiness())
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"status": "unavailable", "reason": "shutting down"}`, rr.Body.String())
+	assert.Equal(t, http.StatusOK, probe(checker.Liveness()).Code)
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	checker := NewChecker(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 10*time.Millisecond)
+
+	start := time.Now()
+	assert.Equal(t, http.StatusServiceUnavailable, probe(checker.Readiness()).Code)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,79 @@
+// Package logging configures the slog logger of the service. Records logged
+// with a request context are tagged with its request ID, and attributes that
+// may carry user content are redacted.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type Config struct {
+	// Level is 'debug', 'info', 'warn' or 'error'.
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+const redacted = "[REDACTED]"
+
+// redactedKeys are attributes never written to the log: comment text and
+// GraphQL variables, which hold whatever users send.
+var redactedKeys = map[string]struct{}{
+	"text":      {},
+	"variables": {},
+}
+
+// New returns a logger writing records of at least cfg.Level to w.
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, expected 'debug', 'info', 'warn' or 'error'", cfg.Level)
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected 'json' or 'text'", cfg.Format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+func redact(_ []string, attr slog.Attr) slog.Attr {
+	if _, ok := redactedKeys[attr.Key]; ok {
+		return slog.String(attr.Key, redacted)
+	}
+	return attr
+}
+
+// contextHandler adds the request ID of the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
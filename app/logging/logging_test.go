@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ozontz/app/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func withLogger(t *testing.T, cfg Config) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := New(&buf, cfg)
+	require.NoError(t, err)
+
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, Config{Level: "verbose", Format: FormatJSON})
+	assert.ErrorContains(t, err, "invalid log level")
+	_, err = New(&bytes.Buffer{}, Config{Level: "info", Format: "xml"})
+	assert.ErrorContains(t, err, "invalid log format")
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, Config{Level: "warn", Format: FormatText})
+	require.NoError(t, err)
+	logger.Info("dropped")
+	logger.Warn("kept")
+	assert.NotContains(t, buf.String(), "dropped")
+	assert.Contains(t, buf.String(), "msg=kept")
+}
+
+func TestRedaction(t *testing.T) {
+	buf := withLogger(t, Config{Level: "info", Format: FormatJSON})
+
+	comment := &models.Comment{ID: "com-1", PostID: "post-1", AuthorID: "user-1", Text: "secret text"}
+	slog.Info("Comment added", "comment", comment)
+	slog.Info("Operation", "variables", map[string]interface{}{"text": "secret text"})
+	slog.Info("Nested", slog.Group("input", "text", "secret text"))
+
+	assert.NotContains(t, buf.String(), "secret text")
+	records := decodeRecords(t, buf)
+	require.Len(t, records, 3)
+	assert.Equal(t, map[string]interface{}{"id": "com-1", "post_id": "post-1", "author_id": "user-1"}, records[0]["comment"])
+	assert.Equal(t, redacted, records[1]["variables"])
+	assert.Equal(t, map[string]interface{}{"text": redacted}, records[2]["input"])
+}
+
+func TestMiddleware(t *testing.T) {
+	buf := withLogger(t, Config{Level: "info", Format: FormatJSON})
+
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+		slog.InfoContext(r.Context(), "Handling")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	t.Run("Generated ID", func(t *testing.T) {
+		buf.Reset()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/query", nil))
+
+		id := rr.Header().Get(RequestIDHeader)
+		assert.Len(t, id, 32)
+		assert.Equal(t, id, seen)
+
+		records := decodeRecords(t, buf)
+		require.Len(t, records, 2)
+		assert.Equal(t, id, records[0]["request_id"], "records logged with the request context are tagged")
+		assert.Equal(t, "Request served", records[1]["msg"])
+		assert.Equal(t, id, records[1]["request_id"])
+		assert.Equal(t, "/query", records[1]["path"])
+		assert.Equal(t, float64(http.StatusTeapot), records[1]["status"])
+		assert.Contains(t, records[1], "duration_ms")
+	})
+
+	t.Run("Client ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.Header.Set(RequestIDHeader, "client-id-1")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, "client-id-1", rr.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("Invalid client ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.Header.Set(RequestIDHeader, "bad id\twith spaces")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Len(t, rr.Header().Get(RequestIDHeader), 32)
+	})
+}
+
+func TestRequestIDOutsideRequest(t *testing.T) {
+	assert.Empty(t, RequestID(context.Background()))
+}
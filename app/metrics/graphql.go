@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// GraphQLExtension times the resolvers of top-level fields. It is added to
+// the schema with Schema.AddExtensions.
+type GraphQLExtension struct{}
+
+var _ graphql.Extension = GraphQLExtension{}
+
+func (GraphQLExtension) Init(ctx context.Context, _ *graphql.Params) context.Context {
+	return ctx
+}
+
+func (GraphQLExtension) Name() string {
+	return "metrics"
+}
+
+func (GraphQLExtension) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(error) {}
+}
+
+func (GraphQLExtension) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func([]gqlerrors.FormattedError) {}
+}
+
+func (GraphQLExtension) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(*graphql.Result) {}
+}
+
+func (GraphQLExtension) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	if info.Path == nil || info.Path.Prev != nil {
+		return ctx, func(interface{}, error) {}
+	}
+
+	field := info.ParentType.Name() + "." + info.FieldName
+	start := time.Now()
+	return ctx, func(interface{}, error) {
+		fieldDuration.WithLabelValues(field).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (GraphQLExtension) HasResult() bool {
+	return false
+}
+
+func (GraphQLExtension) GetResult(context.Context) interface{} {
+	return nil
+}
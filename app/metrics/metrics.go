@@ -0,0 +1,109 @@
+// Package metrics collects the Prometheus metrics of the service and serves
+// them on /metrics.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ozontz"
+
+// Registry holds every metric of the service along with the Go runtime and
+// process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of GraphQL operations by operation name and type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "type"})
+
+	fieldDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "field_duration_seconds",
+		Help:      "Duration of resolving top-level GraphQL fields.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"field"})
+
+	graphqlErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "errors_total",
+		Help:      "GraphQL errors returned to clients by extensions.code.",
+	}, []string{"code"})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "call_duration_seconds",
+		Help:      "Duration of Storage method calls by method and outcome.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		operationDuration,
+		fieldDuration,
+		graphqlErrors,
+		storageDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveOperation records an executed GraphQL operation and the codes of
+// the errors it returned.
+func ObserveOperation(name, operationType string, duration time.Duration, codes []string) {
+	if operationType == "" {
+		operationType = "unknown"
+	}
+	operationDuration.WithLabelValues(operationNames.label(name), operationType).Observe(duration.Seconds())
+	for _, code := range codes {
+		graphqlErrors.WithLabelValues(code).Inc()
+	}
+}
+
+// maxOperationNames bounds the operation label: operation names are chosen
+// by clients, so each new one would otherwise create new series.
+const maxOperationNames = 200
+
+var operationNames = &nameSet{names: make(map[string]struct{})}
+
+type nameSet struct {
+	mu    sync.Mutex
+	names map[string]struct{}
+}
+
+func (s *nameSet) label(name string) string {
+	if name == "" {
+		return "anonymous"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.names[name]; ok {
+		return name
+	}
+	if len(s.names) >= maxOperationNames {
+		return "other"
+	}
+	s.names[name] = struct{}{}
+	return name
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ozontz/app/models"
+	"ozontz/app/storage"
+
+	"github.com/graphql-go/graphql"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleCount returns the number of observations of a histogram series.
+func sampleCount(t *testing.T, vec *prometheus.HistogramVec, labels ...string) uint64 {
+	var m dto.Metric
+	require.NoError(t, vec.WithLabelValues(labels...).(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrumentedStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewInstrumentedStorage(storage.NewStorageInMemory())
+
+	okBefore := sampleCount(t, storageDuration, "CreatePost", "ok")
+	notFoundBefore := sampleCount(t, storageDuration, "GetPostByID", "not_found")
+
+	post, err := store.CreatePost(ctx, &models.Post{Title: "Title", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+	_, err = store.GetPostByID(ctx, "post-missing")
+	assert.ErrorIs(t, err, storage.ErrPostNotFound, "errors should pass through unchanged")
+
+	assert.Equal(t, okBefore+1, sampleCount(t, storageDuration, "CreatePost", "ok"))
+	assert.Equal(t, notFoundBefore+1, sampleCount(t, storageDuration, "GetPostByID", "not_found"))
+
+	found, err := store.GetPostByID(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, post.ID, found.ID)
+}
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, "ok", outcome(nil))
+	assert.Equal(t, "invalid_input", outcome(storage.ErrInvalidCursor))
+	assert.Equal(t, "conflict", outcome(storage.ErrCommentDeleted))
+	assert.Equal(t, "comments_disabled", outcome(storage.ErrCommentsDisabled))
+	assert.Equal(t, "canceled", outcome(fmt.Errorf("query: %w", context.Canceled)))
+	assert.Equal(t, "error", outcome(fmt.Errorf("connection reset")))
+}
+
+func TestObserveOperation(t *testing.T) {
+	before := sampleCount(t, operationDuration, "GetPosts", "query")
+	codeBefore := sampleCounter(t, graphqlErrors, "NOT_FOUND")
+
+	ObserveOperation("GetPosts", "query", time.Millisecond, []string{"NOT_FOUND", "NOT_FOUND"})
+
+	assert.Equal(t, before+1, sampleCount(t, operationDuration, "GetPosts", "query"))
+	assert.Equal(t, codeBefore+2, sampleCounter(t, graphqlErrors, "NOT_FOUND"))
+}
+
+func sampleCounter(t *testing.T, vec *prometheus.CounterVec, labels ...string) float64 {
+	var m dto.Metric
+	require.NoError(t, vec.WithLabelValues(labels...).Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func TestOperationNamesAreBounded(t *testing.T) {
+	names := &nameSet{names: make(map[string]struct{})}
+	for i := 0; i < maxOperationNames; i++ {
+		assert.Equal(t, fmt.Sprintf("Op%d", i), names.label(fmt.Sprintf("Op%d", i)))
+	}
+
+	assert.Equal(t, "other", names.label("OneTooMany"))
+	assert.Equal(t, "Op0", names.label("Op0"), "known names keep their label")
+	assert.Equal(t, "anonymous", names.label(""))
+}
+
+func TestGraphQLExtension(t *testing.T) {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"hello": &graphql.Field{
+					Type: graphql.NewObject(graphql.ObjectConfig{
+						Name:   "Hello",
+						Fields: graphql.Fields{"world": &graphql.Field{Type: graphql.String}},
+					}),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return map[string]interface{}{"world": "!"}, nil
+					},
+				},
+			},
+		}),
+	})
+	require.NoError(t, err)
+	schema.AddExtensions(GraphQLExtension{})
+
+	before := sampleCount(t, fieldDuration, "Query.hello")
+	result := graphql.Do(graphql.Params{Schema: schema, RequestString: "{ hello { world } }"})
+	require.Empty(t, result.Errors)
+
+	assert.Equal(t, before+1, sampleCount(t, fieldDuration, "Query.hello"))
+	assert.Zero(t, sampleCount(t, fieldDuration, "Hello.world"), "nested fields are not timed")
+}
+
+func TestHandler(t *testing.T) {
+	NewInstrumentedStorage(storage.NewStorageInMemory()).GetPosts(context.Background(), storage.PageArgs{})
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `ozontz_storage_call_duration_seconds_count{method="GetPosts",outcome="ok"}`)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
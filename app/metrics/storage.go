@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"ozontz/app/models"
+	"ozontz/app/storage"
+	"time"
+)
+
+// InstrumentedStorage records the duration and outcome of every call to the
+// Storage it wraps.
+type InstrumentedStorage struct {
+	next storage.Storage
+}
+
+var _ storage.Storage = (*InstrumentedStorage)(nil)
+
+func NewInstrumentedStorage(next storage.Storage) *InstrumentedStorage {
+	return &InstrumentedStorage{next: next}
+}
+
+func observeStorage(method string, start time.Time, err error) {
+	storageDuration.WithLabelValues(method, outcome(err)).Observe(time.Since(start).Seconds())
+}
+
+// outcome classifies a storage error, so that expected ones like missing
+// posts can be told apart from failures.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, storage.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, storage.ErrInvalidInput):
+		return "invalid_input"
+	case errors.Is(err, storage.ErrConflict):
+		return "conflict"
+	case errors.Is(err, storage.ErrCommentsDisabled):
+		return "comments_disabled"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
+
+func (s *InstrumentedStorage) GetPosts(ctx context.Context, page storage.PageArgs) (*storage.Page[*models.Post], error) {
+	start := time.Now()
+	posts, err := s.next.GetPosts(ctx, page)
+	observeStorage("GetPosts", start, err)
+	return posts, err
+}
+
+func (s *InstrumentedStorage) GetPostByID(ctx context.Context, id string) (*models.Post, error) {
+	start := time.Now()
+	post, err := s.next.GetPostByID(ctx, id)
+	observeStorage("GetPostByID", start, err)
+	return post, err
+}
+
+func (s *InstrumentedStorage) CreatePost(ctx context.Context, post *models.Post) (*models.Post, error) {
+	start := time.Now()
+	created, err := s.next.CreatePost(ctx, post)
+	observeStorage("CreatePost", start, err)
+	return created, err
+}
+
+func (s *InstrumentedStorage) UpdatePost(ctx context.Context, id string, title, content *string) (*models.Post, error) {
+	start := time.Now()
+	post, err := s.next.UpdatePost(ctx, id, title, content)
+	observeStorage("UpdatePost", start, err)
+	return post, err
+}
+
+func (s *InstrumentedStorage) DeletePost(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.next.DeletePost(ctx, id)
+	observeStorage("DeletePost", start, err)
+	return err
+}
+
+func (s *InstrumentedStorage) SetCommentsAllowed(ctx context.Context, postId string, allowed bool) (*models.Post, error) {
+	start := time.Now()
+	post, err := s.next.SetCommentsAllowed(ctx, postId, allowed)
+	observeStorage("SetCommentsAllowed", start, err)
+	return post, err
+}
+
+func (s *InstrumentedStorage) AddComment(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
+	start := time.Now()
+	added, err := s.next.AddComment(ctx, comment)
+	observeStorage("AddComment", start, err)
+	return added, err
+}
+
+func (s *InstrumentedStorage) GetCommentByID(ctx context.Context, id string) (*models.Comment, error) {
+	start := time.Now()
+	comment, err := s.next.GetCommentByID(ctx, id)
+	observeStorage("GetCommentByID", start, err)
+	return comment, err
+}
+
+func (s *InstrumentedStorage) UpdateComment(ctx context.Context, id string, text string) (*models.Comment, error) {
+	start := time.Now()
+	comment, err := s.next.UpdateComment(ctx, id, text)
+	observeStorage("UpdateComment", start, err)
+	return comment, err
+}
+
+func (s *InstrumentedStorage) DeleteComment(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.next.DeleteComment(ctx, id)
+	observeStorage("DeleteComment", start, err)
+	return err
+}
+
+func (s *InstrumentedStorage) GetComments(ctx context.Context, postId string, page storage.PageArgs) (*storage.Page[*models.Comment], error) {
+	start := time.Now()
+	comments, err := s.next.GetComments(ctx, postId, page)
+	observeStorage("GetComments", start, err)
+	return comments, err
+}
+
+func (s *InstrumentedStorage) GetLatestComment(ctx context.Context, postId string) (*models.Comment, error) {
+	start := time.Now()
+	comment, err := s.next.GetLatestComment(ctx, postId)
+	observeStorage("GetLatestComment", start, err)
+	return comment, err
+}
+
+func (s *InstrumentedStorage) GetLatestComments(ctx context.Context, postIds []string) (map[string]*models.Comment, error) {
+	start := time.Now()
+	comments, err := s.next.GetLatestComments(ctx, postIds)
+	observeStorage("GetLatestComments", start, err)
+	return comments, err
+}
+
+func (s *InstrumentedStorage) GetReplies(ctx context.Context, parentId string, page storage.PageArgs) (*storage.Page[*models.Comment], error) {
+	start := time.Now()
+	replies, err := s.next.GetReplies(ctx, parentId, page)
+	observeStorage("GetReplies", start, err)
+	return replies, err
+}
+
+func (s *InstrumentedStorage) GetCommentThread(ctx context.Context, postId string, depth int) ([]*models.Comment, error) {
+	start := time.Now()
+	comments, err := s.next.GetCommentThread(ctx, postId, depth)
+	observeStorage("GetCommentThread", start, err)
+	return comments, err
+}
+
+func (s *InstrumentedStorage) HealthCheck(ctx context.Context) error {
+	start := time.Now()
+	err := s.next.HealthCheck(ctx)
+	observeStorage("HealthCheck", start, err)
+	return err
+}
@@ -1,22 +1,42 @@
 package models
 
-import "time"
+import (
+	"log/slog"
+	"time"
+)
 
 type Post struct {
-	ID            string    `json:"id"`
-	Title         string    `json:"title"`
-	Content       string    `json:"content"`
-	AuthorID      string    `json:"authorId"`
-	AllowComments bool      `json:"allowComments"`
-	CreatedAt     time.Time `json:"createdAt"`
-	LastComment   *Comment  `json:"lastComment,omitempty"`
+	ID            string     `json:"id"`
+	Title         string     `json:"title"`
+	Content       string     `json:"content"`
+	AuthorID      string     `json:"authorId"`
+	AllowComments bool       `json:"allowComments"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     *time.Time `json:"updatedAt,omitempty"`
+	LastComment   *Comment   `json:"lastComment,omitempty"`
 }
 
 type Comment struct {
-	ID        string    `json:"id"`
-	PostID    string    `json:"postId"`
-	ParentID  *string   `json:"parentId,omitempty"`
-	AuthorID  string    `json:"authorId"`
-	Text      string    `json:"text"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID        string     `json:"id"`
+	PostID    string     `json:"postId"`
+	ParentID  *string    `json:"parentId,omitempty"`
+	AuthorID  string     `json:"authorId"`
+	Text      string     `json:"text"`
+	Deleted   bool       `json:"deleted"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// LogValue leaves the text out of logged comments.
+func (c *Comment) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", c.ID),
+		slog.String("post_id", c.PostID),
+		slog.String("author_id", c.AuthorID),
+	)
+}
+
+type CommentThread struct {
+	Comment *Comment         `json:"comment"`
+	Replies []*CommentThread `json:"replies"`
 }
@@ -0,0 +1,59 @@
+package persisted
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const manifestFormat = "apollo-persisted-query-manifest"
+
+// Manifest lists the operations approved for a client, in the format
+// generated by @apollo/generate-persisted-query-manifest.
+type Manifest struct {
+	Format     string      `json:"format"`
+	Version    int         `json:"version"`
+	Operations []Operation `json:"operations"`
+}
+
+type Operation struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Body string `json:"body"`
+}
+
+// ReadManifest reads a manifest and checks that every operation ID is the
+// hash of its body.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Format != manifestFormat || manifest.Version != 1 {
+		return nil, fmt.Errorf("unsupported manifest format %q version %d", manifest.Format, manifest.Version)
+	}
+	for _, op := range manifest.Operations {
+		if op.ID != Hash(op.Body) {
+			return nil, fmt.Errorf("operation %s: id is not the SHA-256 of its body", op.Name)
+		}
+	}
+
+	return &manifest, nil
+}
+
+// Preload puts every operation of a manifest into a store.
+func Preload(ctx context.Context, store Store, manifest *Manifest) error {
+	for _, op := range manifest.Operations {
+		if err := store.Put(ctx, op.ID, op.Body); err != nil {
+			return fmt.Errorf("operation %s: %w", op.Name, err)
+		}
+	}
+	return nil
+}
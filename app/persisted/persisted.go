@@ -0,0 +1,140 @@
+// Package persisted stores GraphQL documents that clients refer to by hash
+// instead of sending them with every request.
+package persisted
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Store keeps query documents by the hex SHA-256 of their text.
+type Store interface {
+	// Get reports false when no document is stored under hash.
+	Get(ctx context.Context, hash string) (string, bool, error)
+	Put(ctx context.Context, hash, query string) error
+}
+
+// Hash returns the key a query is stored under, the one clients send as
+// extensions.persistedQuery.sha256Hash.
+func Hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// LRU is an in-memory Store that evicts the least recently used documents
+// once it holds size of them. A non-positive size keeps every document.
+type LRU struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	hash  string
+	query string
+}
+
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) Get(ctx context.Context, hash string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[hash]
+	if !ok {
+		return "", false, nil
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry).query, true, nil
+}
+
+func (c *LRU) Put(ctx context.Context, hash, query string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[hash]; ok {
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.items[hash] = c.order.PushFront(&lruEntry{hash: hash, query: query})
+
+	if c.size > 0 && c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).hash)
+	}
+	return nil
+}
+
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// PostgresStore keeps documents in the persisted_queries table, so they are
+// shared by every instance and survive restarts. Once it holds size documents
+// the oldest ones are deleted; a non-positive size keeps every document.
+type PostgresStore struct {
+	db   *sql.DB
+	size int
+}
+
+func NewPostgresStore(db *sql.DB, size int) *PostgresStore {
+	return &PostgresStore{db: db, size: size}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, hash string) (string, bool, error) {
+	var query string
+	err := s.db.QueryRowContext(ctx, "SELECT query FROM persisted_queries WHERE hash = $1", hash).Scan(&query)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get persisted query: %w", err)
+	}
+	return query, true, nil
+}
+
+func (s *PostgresStore) Put(ctx context.Context, hash, document string) error {
+	query := `
+        INSERT INTO persisted_queries (hash, query)
+        VALUES ($1, $2)
+        ON CONFLICT (hash) DO NOTHING
+    `
+
+	result, err := s.db.ExecContext(ctx, query, hash, document)
+	if err != nil {
+		return fmt.Errorf("failed to put persisted query: %w", err)
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 || s.size <= 0 {
+		return nil
+	}
+
+	evict := `
+        DELETE FROM persisted_queries
+        WHERE hash NOT IN (
+            SELECT hash FROM persisted_queries
+            ORDER BY created_at DESC, hash DESC
+            LIMIT $1
+        )
+    `
+
+	if _, err := s.db.ExecContext(ctx, evict, s.size); err != nil {
+		return fmt.Errorf("failed to evict persisted queries: %w", err)
+	}
+	return nil
+}
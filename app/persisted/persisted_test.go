@@ -0,0 +1,124 @@
+package persisted
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestHash(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", Hash(""))
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRU(2)
+
+	require.NoError(t, cache.Put(ctx, "a", "{ a }"))
+	require.NoError(t, cache.Put(ctx, "b", "{ b }"))
+	_, ok, _ := cache.Get(ctx, "a")
+	require.True(t, ok)
+	require.NoError(t, cache.Put(ctx, "c", "{ c }"))
+
+	_, ok, _ = cache.Get(ctx, "b")
+	assert.False(t, ok, "b was used least recently")
+	query, ok, err := cache.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "{ a }", query)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestLRUUnbounded(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRU(0)
+	for _, hash := range []string{"a", "b", "c"} {
+		require.NoError(t, cache.Put(ctx, hash, "{ "+hash+" }"))
+	}
+	assert.Equal(t, 3, cache.Len())
+}
+
+// The queries of PostgresStore are plain SQL, so they are checked against
+// the Postgres migration applied to SQLite.
+func TestPostgresStore(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	migration, err := os.ReadFile("../../migrations/008_create_persisted_queries_table.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(migration))
+	require.NoError(t, err)
+
+	store := NewPostgresStore(db, 2)
+	_, ok, err := store.Get(ctx, Hash("{ posts { totalCount } }"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.Put(ctx, Hash("{ posts { totalCount } }"), "{ posts { totalCount } }"))
+	require.NoError(t, store.Put(ctx, Hash("{ posts { totalCount } }"), "{ posts { totalCount } }"), "putting a document twice is not an error")
+
+	query, ok, err := store.Get(ctx, Hash("{ posts { totalCount } }"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "{ posts { totalCount } }", query)
+
+	_, err = db.Exec("UPDATE persisted_queries SET created_at = '2020-01-01 00:00:00'")
+	require.NoError(t, err)
+	require.NoError(t, store.Put(ctx, "b", "{ b }"))
+	require.NoError(t, store.Put(ctx, "c", "{ c }"))
+
+	_, ok, err = store.Get(ctx, Hash("{ posts { totalCount } }"))
+	require.NoError(t, err)
+	assert.False(t, ok, "the oldest document is evicted")
+	_, ok, _ = store.Get(ctx, "c")
+	assert.True(t, ok)
+}
+
+func writeManifest(t *testing.T, manifest Manifest) string {
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
+
+func TestReadManifest(t *testing.T) {
+	body := "query Posts { posts { totalCount } }"
+	path := writeManifest(t, Manifest{
+		Format:     manifestFormat,
+		Version:    1,
+		Operations: []Operation{{ID: Hash(body), Name: "Posts", Type: "query", Body: body}},
+	})
+
+	manifest, err := ReadManifest(path)
+	require.NoError(t, err)
+
+	store := NewLRU(0)
+	require.NoError(t, Preload(context.Background(), store, manifest))
+	query, ok, _ := store.Get(context.Background(), Hash(body))
+	assert.True(t, ok)
+	assert.Equal(t, body, query)
+}
+
+func TestReadManifestRejectsWrongID(t *testing.T) {
+	path := writeManifest(t, Manifest{
+		Format:     manifestFormat,
+		Version:    1,
+		Operations: []Operation{{ID: Hash("{ a }"), Name: "Posts", Type: "query", Body: "{ b }"}},
+	})
+
+	_, err := ReadManifest(path)
+	assert.ErrorContains(t, err, "operation Posts")
+
+	_, err = ReadManifest(writeManifest(t, Manifest{Format: "relay", Version: 1}))
+	assert.ErrorContains(t, err, "unsupported manifest format")
+}
@@ -0,0 +1,83 @@
+package pubsub
+
+import (
+	"ozontz/app/models"
+	"sync"
+)
+
+const subscriberBuffer = 16
+
+type Broker interface {
+	Publish(comment *models.Comment)
+	Subscribe(postId string) (<-chan *models.Comment, func())
+}
+
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan *models.Comment]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[string]map[chan *models.Comment]struct{}),
+	}
+}
+
+func (h *Hub) Subscribe(postId string) (<-chan *models.Comment, func()) {
+	ch := make(chan *models.Comment, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[postId] == nil {
+		h.subscribers[postId] = make(map[chan *models.Comment]struct{})
+	}
+	h.subscribers[postId][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			delete(h.subscribers[postId], ch)
+			if len(h.subscribers[postId]) == 0 {
+				delete(h.subscribers, postId)
+			}
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+func (h *Hub) HasSubscribers(postId string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.subscribers[postId]) > 0
+}
+
+// Topics returns the IDs of the posts that have subscribers.
+func (h *Hub) Topics() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	postIds := make([]string, 0, len(h.subscribers))
+	for postId := range h.subscribers {
+		postIds = append(postIds, postId)
+	}
+	return postIds
+}
+
+func (h *Hub) Publish(comment *models.Comment) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers[comment.PostID] {
+		select {
+		case ch <- comment:
+		default:
+			// Slow subscriber: drop the event rather than block the writer.
+		}
+	}
+}
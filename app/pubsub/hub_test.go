@@ -0,0 +1,61 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"ozontz/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHubPublish(t *testing.T) {
+	hub := NewHub()
+
+	events, unsubscribe := hub.Subscribe("post-1")
+	defer unsubscribe()
+	other, unsubscribeOther := hub.Subscribe("post-2")
+	defer unsubscribeOther()
+
+	hub.Publish(&models.Comment{ID: "com-1", PostID: "post-1"})
+
+	select {
+	case comment := <-events:
+		assert.Equal(t, "com-1", comment.ID, "Subscriber should receive the published comment")
+	case <-time.After(time.Second):
+		t.Fatal("Subscriber did not receive the published comment")
+	}
+
+	select {
+	case comment := <-other:
+		t.Fatalf("Subscriber of another post received %s", comment.ID)
+	default:
+	}
+}
+
+func TestHubUnsubscribe(t *testing.T) {
+	hub := NewHub()
+
+	events, unsubscribe := hub.Subscribe("post-1")
+	unsubscribe()
+	unsubscribe()
+
+	_, open := <-events
+	assert.False(t, open, "Channel should be closed after unsubscribe")
+	assert.Empty(t, hub.subscribers, "Hub should forget posts without subscribers")
+
+	hub.Publish(&models.Comment{ID: "com-1", PostID: "post-1"})
+}
+
+func TestHubTopics(t *testing.T) {
+	hub := NewHub()
+	assert.Empty(t, hub.Topics())
+
+	_, unsubscribe := hub.Subscribe("post-1")
+	_, unsubscribeOther := hub.Subscribe("post-2")
+	defer unsubscribeOther()
+	assert.ElementsMatch(t, []string{"post-1", "post-2"}, hub.Topics())
+
+	unsubscribe()
+	assert.Equal(t, []string{"post-2"}, hub.Topics())
+}
@@ -0,0 +1,53 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"ozontz/app/storage"
+	"ozontz/app/storage/storagetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryConformance(t *testing.T) {
+	storagetest.Run(t, func() storage.Storage {
+		return storage.NewStorageInMemory()
+	})
+}
+
+func TestPostgresConformance(t *testing.T) {
+	db, teardown := storage.SetupTestDB(t)
+	defer teardown()
+
+	storagetest.Run(t, func() storage.Storage {
+		_, err := db.Exec("TRUNCATE comments, posts")
+		require.NoError(t, err)
+		return storage.NewStoragePostgres(db)
+	})
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	db, err := storage.InitSQLiteDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	storagetest.Run(t, func() storage.Storage {
+		_, err := db.Exec("DELETE FROM posts")
+		require.NoError(t, err)
+		return storage.NewStorageSQLite(db)
+	})
+}
+
+func TestInMemoryWALConformance(t *testing.T) {
+	storagetest.Run(t, func() storage.Storage {
+		store, err := storage.NewStorageInMemoryWithWAL(storage.WALConfig{
+			Dir:          t.TempDir(),
+			Fsync:        storage.FsyncNever,
+			CompactAfter: 20,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
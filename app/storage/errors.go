@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error categories. Every error returned by a Storage implementation for a
+// missing entity matches ErrNotFound, every rejected argument matches
+// ErrInvalidInput and every write that clashes with the current state matches
+// ErrConflict, so callers can classify them with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrInvalidInput = errors.New("invalid input")
+	ErrConflict     = errors.New("conflict")
+)
+
+var (
+	ErrPostNotFound     = newError(ErrNotFound, "post not found")
+	ErrCommentNotFound  = newError(ErrNotFound, "comment not found")
+	ErrParentNotFound   = newError(ErrNotFound, "parent comment not found")
+	ErrParentMismatch   = newError(ErrInvalidInput, "parent comment belongs to another post")
+	ErrThreadTooDeep    = newError(ErrInvalidInput, fmt.Sprintf("replies cannot be nested deeper than %d levels", maxCommentDepth))
+	ErrInvalidCursor    = newError(ErrInvalidInput, "invalid cursor")
+	ErrTextTooLong      = newError(ErrInvalidInput, "comment text is too long")
+	ErrCommentDeleted   = newError(ErrConflict, "comment has been deleted")
+	ErrCommentsDisabled = errors.New("comments are disabled for this post")
+)
+
+// errTextTooLong is ErrTextTooLong naming the configured limit.
+func errTextTooLong() error {
+	return newError(ErrTextTooLong, fmt.Sprintf("comment text exceeds %d characters", limits.MaxTextLength))
+}
+
+type storageError struct {
+	kind    error
+	message string
+}
+
+func newError(kind error, message string) error {
+	return &storageError{kind: kind, message: message}
+}
+
+func (e *storageError) Error() string {
+	return e.message
+}
+
+func (e *storageError) Unwrap() error {
+	return e.kind
+}
@@ -0,0 +1,5 @@
+package storage
+
+// SetupTestDB exposes the Postgres test container to the external
+// storage_test package.
+var SetupTestDB = setupTestDB
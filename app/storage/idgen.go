@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IDGenerator produces the IDs of new posts and comments. IDs have to be
+// unique across every instance sharing a database and should sort in
+// creation order, so that (created_at, id) ties resolve the way rows were
+// inserted.
+type IDGenerator interface {
+	NewID() string
+}
+
+var ids IDGenerator = &ULIDGenerator{}
+
+// SetIDGenerator replaces the generator used by every storage backend. It is
+// meant to be called once at startup.
+func SetIDGenerator(gen IDGenerator) {
+	ids = gen
+}
+
+// NewIDGenerator returns the generator for a -id-format value.
+func NewIDGenerator(format string) (IDGenerator, error) {
+	switch format {
+	case "ulid":
+		return &ULIDGenerator{}, nil
+	case "uuidv7":
+		return &UUIDv7Generator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown ID format %q, expected 'ulid' or 'uuidv7'", format)
+	}
+}
+
+func newID(contentType string) string {
+	return contentType + ids.NewID()
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator produces ULIDs (https://github.com/ulid/spec): 26 characters
+// holding a millisecond timestamp and 80 random bits. IDs generated within
+// the same millisecond increment the random part, so they stay ordered.
+type ULIDGenerator struct {
+	mu      sync.Mutex
+	lastMs  int64
+	entropy [10]byte
+}
+
+func (g *ULIDGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if ms := time.Now().UnixMilli(); ms > g.lastMs {
+		g.lastMs = ms
+		readRandom(g.entropy[:])
+	} else if !increment(g.entropy[:]) {
+		// 2^80 IDs in one millisecond: borrow the next one.
+		g.lastMs++
+		readRandom(g.entropy[:])
+	}
+
+	var raw [16]byte
+	putUint48(raw[:6], g.lastMs)
+	copy(raw[6:], g.entropy[:])
+
+	hi := binary.BigEndian.Uint64(raw[:8])
+	lo := binary.BigEndian.Uint64(raw[8:])
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// UUIDv7Generator produces version 7 UUIDs (RFC 9562): a millisecond
+// timestamp followed by 74 random bits. IDs generated within the same
+// millisecond increment the random part, so they stay ordered.
+type UUIDv7Generator struct {
+	mu     sync.Mutex
+	lastMs int64
+	randA  uint16 // 12 bits
+	randB  uint64 // 62 bits
+}
+
+func (g *UUIDv7Generator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if ms := time.Now().UnixMilli(); ms > g.lastMs {
+		g.lastMs = ms
+		g.reseed()
+	} else if g.randB++; g.randB == 1<<62 {
+		g.randB = 0
+		if g.randA++; g.randA == 1<<12 {
+			g.lastMs++
+			g.reseed()
+		}
+	}
+
+	var raw [16]byte
+	putUint48(raw[:6], g.lastMs)
+	binary.BigEndian.PutUint16(raw[6:8], 0x7000|g.randA)
+	binary.BigEndian.PutUint64(raw[8:], 1<<63|g.randB)
+
+	var out [36]byte
+	hex.Encode(out[0:8], raw[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], raw[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], raw[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], raw[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], raw[10:])
+	return string(out[:])
+}
+
+func (g *UUIDv7Generator) reseed() {
+	var b [10]byte
+	readRandom(b[:])
+	g.randA = binary.BigEndian.Uint16(b[:2]) & (1<<12 - 1)
+	g.randB = binary.BigEndian.Uint64(b[2:]) & (1<<62 - 1)
+}
+
+func readRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand only fails when the OS has no entropy source left.
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+}
+
+// increment adds one to a big-endian number and reports false on overflow.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func putUint48(b []byte, v int64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
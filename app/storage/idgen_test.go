@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDGenerators(t *testing.T) {
+	formats := map[string]*regexp.Regexp{
+		"ulid":   regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`),
+		"uuidv7": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+	}
+
+	for format, pattern := range formats {
+		t.Run(format, func(t *testing.T) {
+			gen, err := NewIDGenerator(format)
+			require.NoError(t, err)
+
+			t.Run("Format", func(t *testing.T) {
+				assert.Regexp(t, pattern, gen.NewID())
+			})
+
+			t.Run("Ordered", func(t *testing.T) {
+				generated := make([]string, 10000)
+				for i := range generated {
+					generated[i] = gen.NewID()
+				}
+				assert.True(t, sort.StringsAreSorted(generated), "IDs should sort in generation order")
+			})
+
+			t.Run("Unique", func(t *testing.T) {
+				const workers, perWorker = 8, 5000
+
+				var mu sync.Mutex
+				seen := make(map[string]bool, workers*perWorker)
+				var wg sync.WaitGroup
+				for w := 0; w < workers; w++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						local := make([]string, perWorker)
+						for i := range local {
+							local[i] = gen.NewID()
+						}
+						mu.Lock()
+						defer mu.Unlock()
+						for _, id := range local {
+							seen[id] = true
+						}
+					}()
+				}
+				wg.Wait()
+
+				assert.Len(t, seen, workers*perWorker)
+			})
+		})
+	}
+
+	_, err := NewIDGenerator("counter")
+	assert.Error(t, err)
+}
+
+func TestULIDEncodesTimestamp(t *testing.T) {
+	gen := &ULIDGenerator{lastMs: 1<<48 - 1}
+	gen.entropy = [10]byte{}
+
+	// The timestamp is already in the future, so the entropy is incremented
+	// and the maximum timestamp shows up as the leading characters.
+	assert.Equal(t, "7ZZZZZZZZZ0000000000000001", gen.NewID())
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"slices"
+	"sort"
+)
+
+// sortedIndex keeps items ordered by (CreatedAt, ID) so that pages and the
+// newest item are found by binary search rather than by scanning and sorting
+// the whole collection. New items are almost always the newest, which makes
+// inserting an append.
+type sortedIndex[T any] struct {
+	key   func(T) Cursor
+	items []T
+}
+
+func newSortedIndex[T any](key func(T) Cursor) *sortedIndex[T] {
+	return &sortedIndex[T]{key: key}
+}
+
+// search returns the position of the first item not ordered before c.
+func (ix *sortedIndex[T]) search(c Cursor) int {
+	return sort.Search(len(ix.items), func(i int) bool {
+		return !ix.key(ix.items[i]).less(c)
+	})
+}
+
+// find returns the position of the item with the same key as item.
+func (ix *sortedIndex[T]) find(item T) (int, bool) {
+	k := ix.key(item)
+	i := ix.search(k)
+	return i, i < len(ix.items) && !k.less(ix.key(ix.items[i]))
+}
+
+// put inserts item, or replaces the item with the same key.
+func (ix *sortedIndex[T]) put(item T) {
+	i, found := ix.find(item)
+	switch {
+	case found:
+		ix.items[i] = item
+	case i == len(ix.items):
+		ix.items = append(ix.items, item)
+	default:
+		ix.items = slices.Insert(ix.items, i, item)
+	}
+}
+
+func (ix *sortedIndex[T]) remove(item T) {
+	if i, found := ix.find(item); found {
+		ix.items = slices.Delete(ix.items, i, i+1)
+	}
+}
+
+// The read methods below accept a nil index, which stands for an empty one.
+
+func (ix *sortedIndex[T]) len() int {
+	if ix == nil {
+		return 0
+	}
+	return len(ix.items)
+}
+
+// last returns the newest item, or the zero value of an empty index.
+func (ix *sortedIndex[T]) last() T {
+	var zero T
+	if ix.len() == 0 {
+		return zero
+	}
+	return ix.items[len(ix.items)-1]
+}
+
+func (ix *sortedIndex[T]) page(q pageQuery, desc bool) *Page[T] {
+	if ix == nil {
+		return paginate[T](nil, nil, desc, q)
+	}
+	return paginate(ix.items, ix.key, desc, q)
+}
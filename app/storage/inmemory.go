@@ -2,145 +2,493 @@ package storage
 
 import (
 	"context"
-	"errors"
 	"ozontz/app/models"
 	"sort"
-	"strconv"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 type InMemoryStorage struct {
-	mu               sync.Mutex
-	posts            map[string]*models.Post
-	comments         map[string]*models.Comment
-	postIdCounter    int
-	commentIdCounter int
+	mu       sync.RWMutex
+	posts    map[string]*models.Post
+	comments map[string]*models.Comment
+
+	// Indexes ordered by (CreatedAt, ID) and kept in step with the maps above
+	// by putPost, putComment and their remove counterparts: all posts, the
+	// comments of each post, the top-level comments of each post and the
+	// replies to each comment. The newest root is the latest comment of a
+	// post, so it never has to be searched for.
+	postIndex    *sortedIndex[*models.Post]
+	postComments map[string]*sortedIndex[*models.Comment]
+	roots        map[string]*sortedIndex[*models.Comment]
+	replies      map[string]*sortedIndex[*models.Comment]
+
+	// wal is nil unless the store was opened with NewStorageInMemoryWithWAL.
+	wal *wal
 }
 
 func NewStorageInMemory() *InMemoryStorage {
 	return &InMemoryStorage{
-		posts:    make(map[string]*models.Post),
-		comments: make(map[string]*models.Comment),
+		posts:        make(map[string]*models.Post),
+		comments:     make(map[string]*models.Comment),
+		postIndex:    newSortedIndex(postCursor),
+		postComments: make(map[string]*sortedIndex[*models.Comment]),
+		roots:        make(map[string]*sortedIndex[*models.Comment]),
+		replies:      make(map[string]*sortedIndex[*models.Comment]),
 	}
 }
 
-func (s *InMemoryStorage) GetPosts(ctx context.Context) ([]*models.Post, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	var posts []*models.Post
+func (s *InMemoryStorage) GetPosts(ctx context.Context, page PageArgs) (*Page[*models.Post], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	for _, post := range s.posts {
-		posts = append(posts, post)
+	q, err := newPageQuery(page, limits.PostsPageSize)
+	if err != nil {
+		return nil, err
 	}
 
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].CreatedAt.After(posts[j].CreatedAt)
-	})
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return posts, nil
+	return s.postIndex.page(q, true), nil
 }
 
 func (s *InMemoryStorage) GetPostByID(ctx context.Context, id string) (*models.Post, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	post, exists := s.posts[id]
 	if !exists {
-		return nil, errors.New("post not found")
+		return nil, ErrPostNotFound
 	}
 	return post, nil
 }
 
 func (s *InMemoryStorage) CreatePost(ctx context.Context, post *models.Post) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.postIdCounter++
-	post.ID = generateID("post-", s.postIdCounter)
+	post.ID = newID("post-")
 	post.CreatedAt = time.Now().UTC()
-	s.posts[post.ID] = post
+
+	rec := walRecord{Op: opPutPost, Post: post}
+	if err := s.persist(rec); err != nil {
+		return nil, err
+	}
+	s.commit(rec)
 	return post, nil
 }
 
+func (s *InMemoryStorage) UpdatePost(ctx context.Context, id string, title, content *string) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.posts[id]
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+
+	post := *existing
+	if title != nil {
+		post.Title = *title
+	}
+	if content != nil {
+		post.Content = *content
+	}
+	updatedAt := time.Now().UTC()
+	post.UpdatedAt = &updatedAt
+
+	rec := walRecord{Op: opPutPost, Post: &post}
+	if err := s.persist(rec); err != nil {
+		return nil, err
+	}
+	s.commit(rec)
+	return &post, nil
+}
+
+func (s *InMemoryStorage) DeletePost(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.posts[id]; !exists {
+		return ErrPostNotFound
+	}
+
+	rec := walRecord{Op: opDeletePost, ID: id}
+	if err := s.persist(rec); err != nil {
+		return err
+	}
+	s.commit(rec)
+	return nil
+}
+
+func (s *InMemoryStorage) SetCommentsAllowed(ctx context.Context, postId string, allowed bool) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.posts[postId]
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+
+	post := *existing
+	post.AllowComments = allowed
+	updatedAt := time.Now().UTC()
+	post.UpdatedAt = &updatedAt
+
+	rec := walRecord{Op: opPutPost, Post: &post}
+	if err := s.persist(rec); err != nil {
+		return nil, err
+	}
+	s.commit(rec)
+	return &post, nil
+}
+
 func (s *InMemoryStorage) AddComment(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if len(comment.Text) > textLen {
-		return nil, errors.New("comment text exceeds 2000 characters")
+	if utf8.RuneCountInString(comment.Text) > limits.MaxTextLength {
+		return nil, errTextTooLong()
 	}
 
-	if _, exists := s.posts[comment.PostID]; !exists {
-		return nil, errors.New("post not found")
+	post, exists := s.posts[comment.PostID]
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+	if !post.AllowComments {
+		return nil, ErrCommentsDisabled
+	}
+	if comment.ParentID != nil {
+		parent, exists := s.comments[*comment.ParentID]
+		if !exists {
+			return nil, ErrParentNotFound
+		}
+		if parent.PostID != comment.PostID {
+			return nil, ErrParentMismatch
+		}
+		if s.depth(parent) >= maxCommentDepth {
+			return nil, ErrThreadTooDeep
+		}
 	}
 
-	s.commentIdCounter++
-	comment.ID = generateID("com-", s.commentIdCounter)
+	comment.ID = newID("com-")
 	comment.CreatedAt = time.Now().UTC()
-	s.comments[comment.ID] = comment
+
+	rec := walRecord{Op: opPutComment, Comment: comment}
+	if err := s.persist(rec); err != nil {
+		return nil, err
+	}
+	s.commit(rec)
 	return comment, nil
 }
 
-func (s *InMemoryStorage) GetLatestComment(ctx context.Context, postId string) (*models.Comment, error) {
+func (s *InMemoryStorage) GetCommentByID(ctx context.Context, id string) (*models.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	comment, exists := s.comments[id]
+	if !exists {
+		return nil, ErrCommentNotFound
+	}
+	return comment, nil
+}
+
+func (s *InMemoryStorage) UpdateComment(ctx context.Context, id string, text string) (*models.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var lastComment *models.Comment
-	for _, comment := range s.comments {
-		if comment.PostID == postId && comment.ParentID == nil {
-			if lastComment == nil || comment.CreatedAt.After(lastComment.CreatedAt) {
-				lastComment = comment
-			}
-		}
+	if utf8.RuneCountInString(text) > limits.MaxTextLength {
+		return nil, errTextTooLong()
+	}
+
+	existing, exists := s.comments[id]
+	if !exists {
+		return nil, ErrCommentNotFound
 	}
-	return lastComment, nil
+	if existing.Deleted {
+		return nil, ErrCommentDeleted
+	}
+
+	comment := *existing
+	comment.Text = text
+	updatedAt := time.Now().UTC()
+	comment.UpdatedAt = &updatedAt
+
+	rec := walRecord{Op: opPutComment, Comment: &comment}
+	if err := s.persist(rec); err != nil {
+		return nil, err
+	}
+	s.commit(rec)
+	return &comment, nil
 }
 
-func (s *InMemoryStorage) GetComments(ctx context.Context, postId string, after *string) ([]*models.Comment, error) {
+func (s *InMemoryStorage) DeleteComment(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var comments []*models.Comment
-	for _, comment := range s.comments {
-		if comment.PostID == postId {
-			comments = append(comments, comment)
+	existing, exists := s.comments[id]
+	if !exists {
+		return ErrCommentNotFound
+	}
+
+	rec := walRecord{Op: opDeleteComment, ID: id}
+	if s.replies[id].len() > 0 {
+		// Replies keep pointing at a tombstone so the thread stays intact.
+		comment := *existing
+		comment.Text = deletedText
+		comment.Deleted = true
+		updatedAt := time.Now().UTC()
+		comment.UpdatedAt = &updatedAt
+		rec = walRecord{Op: opPutComment, Comment: &comment}
+	}
+
+	if err := s.persist(rec); err != nil {
+		return err
+	}
+	s.commit(rec)
+	return nil
+}
+
+func (s *InMemoryStorage) GetLatestComment(ctx context.Context, postId string) (*models.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.roots[postId].last(), nil
+}
+
+func (s *InMemoryStorage) GetLatestComments(ctx context.Context, postIds []string) (map[string]*models.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest := make(map[string]*models.Comment, len(postIds))
+	for _, postId := range postIds {
+		if comment := s.roots[postId].last(); comment != nil {
+			latest[postId] = comment
 		}
 	}
+	return latest, nil
+}
 
-	sort.Slice(comments, func(i, j int) bool {
-		return comments[i].CreatedAt.After(comments[j].CreatedAt)
-	})
+func (s *InMemoryStorage) GetComments(ctx context.Context, postId string, page PageArgs) (*Page[*models.Comment], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	q, err := newPageQuery(page, limits.CommentsPageSize)
+	if err != nil {
+		return nil, err
+	}
 
-	index := -1
-	if after != nil {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-		for i, comment := range comments {
-			if generateCursor(comment) == *after {
-				index = i
-				break
+	return s.postComments[postId].page(q, false), nil
+}
+
+func (s *InMemoryStorage) GetReplies(ctx context.Context, parentId string, page PageArgs) (*Page[*models.Comment], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	q, err := newPageQuery(page, limits.CommentsPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.replies[parentId].page(q, false), nil
+}
+
+func (s *InMemoryStorage) GetCommentThread(ctx context.Context, postId string, depth int) ([]*models.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.posts[postId]; !exists {
+		return nil, ErrPostNotFound
+	}
+
+	var level []*models.Comment
+	if roots := s.roots[postId]; roots != nil {
+		level = roots.items
+	}
+
+	var thread []*models.Comment
+	for d := 0; d < NormalizeDepth(depth) && len(level) > 0; d++ {
+		thread = append(thread, level...)
+
+		var next []*models.Comment
+		for _, comment := range level {
+			if replies := s.replies[comment.ID]; replies != nil {
+				next = append(next, replies.items...)
 			}
 		}
-		if index == -1 {
-			return nil, errors.New("invalid cursor")
-		}
-		if index != -1 {
-			comments = comments[index+1:]
+		level = next
+	}
+
+	sortComments(thread)
+
+	return thread, nil
+}
+
+// putPost stores a new or updated post. It must be called with s.mu held.
+func (s *InMemoryStorage) putPost(post *models.Post) {
+	s.posts[post.ID] = post
+	s.postIndex.put(post)
+}
+
+// removePost deletes a post together with its comments. It must be called
+// with s.mu held.
+func (s *InMemoryStorage) removePost(id string) {
+	post, exists := s.posts[id]
+	if !exists {
+		return
+	}
+
+	if comments := s.postComments[id]; comments != nil {
+		for _, comment := range comments.items {
+			delete(s.comments, comment.ID)
+			delete(s.replies, comment.ID)
 		}
+	}
+	delete(s.postComments, id)
+	delete(s.roots, id)
+
+	delete(s.posts, id)
+	s.postIndex.remove(post)
+}
+
+// putComment stores a new or updated comment. It must be called with s.mu
+// held.
+func (s *InMemoryStorage) putComment(comment *models.Comment) {
+	s.comments[comment.ID] = comment
+	indexComment(s.postComments, comment.PostID, comment)
+	if comment.ParentID == nil {
+		indexComment(s.roots, comment.PostID, comment)
 	} else {
-		if len(comments) > commentsCount {
-			comments = comments[:commentsCount]
+		indexComment(s.replies, *comment.ParentID, comment)
+	}
+}
+
+// removeComment deletes a comment without replies. It must be called with
+// s.mu held.
+func (s *InMemoryStorage) removeComment(id string) {
+	comment, exists := s.comments[id]
+	if !exists {
+		return
+	}
+
+	delete(s.comments, id)
+	delete(s.replies, id)
+	unindexComment(s.postComments, comment.PostID, comment)
+	if comment.ParentID == nil {
+		unindexComment(s.roots, comment.PostID, comment)
+	} else {
+		unindexComment(s.replies, *comment.ParentID, comment)
+	}
+}
+
+func indexComment(indexes map[string]*sortedIndex[*models.Comment], key string, comment *models.Comment) {
+	ix, exists := indexes[key]
+	if !exists {
+		ix = newSortedIndex(commentCursor)
+		indexes[key] = ix
+	}
+	ix.put(comment)
+}
+
+func unindexComment(indexes map[string]*sortedIndex[*models.Comment], key string, comment *models.Comment) {
+	ix, exists := indexes[key]
+	if !exists {
+		return
+	}
+	ix.remove(comment)
+	if ix.len() == 0 {
+		delete(indexes, key)
+	}
+}
+
+// depth returns the nesting level of a comment, 1 for a top-level one.
+func (s *InMemoryStorage) depth(comment *models.Comment) int {
+	depth := 1
+	for comment.ParentID != nil {
+		parent, exists := s.comments[*comment.ParentID]
+		if !exists {
+			break
 		}
+		comment = parent
+		depth++
 	}
+	return depth
+}
+
+func sortComments(comments []*models.Comment) {
+	sort.Slice(comments, func(i, j int) bool {
+		return commentCursor(comments[i]).less(commentCursor(comments[j]))
+	})
+}
 
-	return comments, nil
+func postCursor(post *models.Post) Cursor {
+	return Cursor{CreatedAt: post.CreatedAt, ID: post.ID}
 }
 
-func generateID(contentType string, counter int) string {
-	return contentType + strconv.Itoa(counter)
+func commentCursor(comment *models.Comment) Cursor {
+	return Cursor{CreatedAt: comment.CreatedAt, ID: comment.ID}
 }
 
-func generateCursor(comment *models.Comment) string {
-	return "cur-" + comment.ID
+// HealthCheck always succeeds: the data lives in the process itself.
+func (s *InMemoryStorage) HealthCheck(ctx context.Context) error {
+	return nil
 }
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"ozontz/app/models"
+)
+
+// benchmarkSizes are comment counts of the post being paged through. With
+// the indexes the time per operation should stay flat as they grow.
+var benchmarkSizes = []int{1_000, 100_000, 1_000_000}
+
+func seedComments(b *testing.B, n int) (*InMemoryStorage, *models.Post, []*models.Comment) {
+	b.Helper()
+	ctx := context.Background()
+
+	store := NewStorageInMemory()
+	post, err := store.CreatePost(ctx, &models.Post{Title: "Title", Content: "Content", AuthorID: "user-1", AllowComments: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Another post's comments must not slow down the first one.
+	other, err := store.CreatePost(ctx, &models.Post{Title: "Other", Content: "Content", AuthorID: "user-1", AllowComments: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	comments := make([]*models.Comment, 0, n)
+	for i := 0; i < n; i++ {
+		postId := post.ID
+		if i%2 == 1 {
+			postId = other.ID
+		}
+		comment, err := store.AddComment(ctx, &models.Comment{PostID: postId, AuthorID: "user-2", Text: "Comment"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if postId == post.ID {
+			comments = append(comments, comment)
+		}
+	}
+
+	return store, post, comments
+}
+
+func BenchmarkInMemoryGetComments(b *testing.B) {
+	ctx := context.Background()
+
+	for _, n := range benchmarkSizes {
+		store, post, comments := seedComments(b, n)
+		middle := comments[len(comments)/2]
+		after := EncodeCursor(middle.CreatedAt, middle.ID)
+		last := 5
+
+		b.Run(fmt.Sprintf("first/comments=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := store.GetComments(ctx, post.ID, PageArgs{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("after/comments=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := store.GetComments(ctx, post.ID, PageArgs{After: &after}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("last/comments=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := store.GetComments(ctx, post.ID, PageArgs{Last: &last}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInMemoryGetLatestComment(b *testing.B) {
+	ctx := context.Background()
+
+	for _, n := range benchmarkSizes {
+		store, post, _ := seedComments(b, n)
+
+		b.Run(fmt.Sprintf("comments=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := store.GetLatestComment(ctx, post.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInMemoryAddComment(b *testing.B) {
+	ctx := context.Background()
+
+	for _, n := range benchmarkSizes {
+		store, post, _ := seedComments(b, n)
+
+		b.Run(fmt.Sprintf("comments=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Comment"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -3,12 +3,14 @@ package storage
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"ozontz/app/models"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInMemoryCreatePost(t *testing.T) {
@@ -46,7 +48,7 @@ func TestInMemoryAddComment(t *testing.T) {
 	store.CreatePost(context.Background(), post)
 
 	comment := &models.Comment{
-		PostID:    "post-1",
+		PostID:    post.ID,
 		ParentID:  nil,
 		AuthorID:  "user-2",
 		Text:      "Test comment",
@@ -77,8 +79,9 @@ func TestInMemoryGetPosts(t *testing.T) {
 		time.Sleep(50 * time.Millisecond)
 	}
 
-	postsList, err := store.GetPosts(context.Background())
+	page, err := store.GetPosts(context.Background(), PageArgs{})
 	assert.NoError(t, err, "GetPosts should not return an error")
+	postsList := page.Items
 	assert.Len(t, postsList, 10, "Should return exactly 10 posts")
 
 	for i := 0; i < len(postsList)-1; i++ {
@@ -102,7 +105,7 @@ func TestInMemoryGetLatestComment(t *testing.T) {
 	for i := 1; i < 5; i++ {
 		comment := &models.Comment{
 			ID:        fmt.Sprintf("com-%d", i),
-			PostID:    "post-1",
+			PostID:    post.ID,
 			ParentID:  nil,
 			AuthorID:  "user-2",
 			Text:      fmt.Sprintf("Test tcomment %d", i),
@@ -119,7 +122,7 @@ func TestInMemoryGetLatestComment(t *testing.T) {
 	assert.WithinDuration(t, now, latestComment.CreatedAt, 1*time.Millisecond, "Latest comment's creation time should be close to the current time")
 
 	childComment := &models.Comment{
-		PostID:    "post-1",
+		PostID:    post.ID,
 		ParentID:  &latestComment.ID,
 		AuthorID:  "user-3",
 		Text:      "Test tcomment child",
@@ -154,3 +157,236 @@ func TestInMemoryGetPostByID(t *testing.T) {
 	assert.Equal(t, post.AllowComments, receivedPost.AllowComments, "Post allow comments flag should match")
 	assert.Equal(t, post.CreatedAt, receivedPost.CreatedAt, "Post creation times should match")
 }
+
+func TestInMemoryGetReplies(t *testing.T) {
+	store := NewStorageInMemory()
+	post, _ := store.CreatePost(context.Background(), &models.Post{Title: "Test Post", AuthorID: "user-1", AllowComments: true})
+
+	parent, err := store.AddComment(context.Background(), &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Parent"})
+	assert.NoError(t, err, "AddComment should not return an error")
+
+	for i := 1; i < 5; i++ {
+		_, err := store.AddComment(context.Background(), &models.Comment{
+			PostID:   post.ID,
+			ParentID: &parent.ID,
+			AuthorID: "user-3",
+			Text:     fmt.Sprintf("Reply %d", i),
+		})
+		assert.NoError(t, err, "AddComment should not return an error")
+		time.Sleep(time.Millisecond)
+	}
+
+	first := 2
+	page, err := store.GetReplies(context.Background(), parent.ID, PageArgs{First: &first})
+	assert.NoError(t, err, "GetReplies should not return an error")
+	assert.Len(t, page.Items, 2, "Should return the requested number of replies")
+	assert.Equal(t, "Reply 1", page.Items[0].Text, "Replies should be sorted by created_at in ascending order")
+	assert.Equal(t, "Reply 2", page.Items[1].Text, "Replies should be sorted by created_at in ascending order")
+	assert.True(t, page.HasNextPage, "Should report more replies")
+	assert.Equal(t, 4, page.TotalCount, "Total count should include all replies")
+
+	after := EncodeCursor(page.Items[1].CreatedAt, page.Items[1].ID)
+	page, err = store.GetReplies(context.Background(), parent.ID, PageArgs{After: &after})
+	assert.NoError(t, err, "GetReplies should not return an error")
+	assert.Len(t, page.Items, 2, "Should return the replies after the cursor")
+	assert.Equal(t, "Reply 3", page.Items[0].Text, "Replies should continue after the cursor")
+	assert.False(t, page.HasNextPage, "Should not report more replies")
+
+	invalid := "cur-com-1"
+	_, err = store.GetReplies(context.Background(), parent.ID, PageArgs{After: &invalid})
+	assert.Error(t, err, "GetReplies should reject a malformed cursor")
+}
+
+func TestInMemoryGetCommentThread(t *testing.T) {
+	store := NewStorageInMemory()
+	post, _ := store.CreatePost(context.Background(), &models.Post{Title: "Test Post", AuthorID: "user-1", AllowComments: true})
+
+	var parentID *string
+	for i := 1; i <= 4; i++ {
+		comment, err := store.AddComment(context.Background(), &models.Comment{
+			PostID:   post.ID,
+			ParentID: parentID,
+			AuthorID: "user-2",
+			Text:     fmt.Sprintf("Level %d", i),
+		})
+		assert.NoError(t, err, "AddComment should not return an error")
+		parentID = &comment.ID
+		time.Sleep(time.Millisecond)
+	}
+
+	thread, err := store.GetCommentThread(context.Background(), post.ID, 2)
+	assert.NoError(t, err, "GetCommentThread should not return an error")
+	assert.Len(t, thread, 2, "Should return comments down to the requested depth")
+	assert.Equal(t, "Level 1", thread[0].Text)
+	assert.Equal(t, "Level 2", thread[1].Text)
+
+	thread, err = store.GetCommentThread(context.Background(), post.ID, 10)
+	assert.NoError(t, err, "GetCommentThread should not return an error")
+	assert.Len(t, thread, 4, "Should return the whole thread")
+
+	_, err = store.GetCommentThread(context.Background(), "post-unknown", 0)
+	assert.Error(t, err, "GetCommentThread should fail for an unknown post")
+}
+
+func TestInMemoryGetCommentsPagination(t *testing.T) {
+	store := NewStorageInMemory()
+	post, _ := store.CreatePost(context.Background(), &models.Post{Title: "Test Post", AuthorID: "user-1", AllowComments: true})
+
+	for i := 1; i <= 7; i++ {
+		_, err := store.AddComment(context.Background(), &models.Comment{
+			PostID:   post.ID,
+			AuthorID: "user-2",
+			Text:     fmt.Sprintf("Comment %d", i),
+		})
+		assert.NoError(t, err, "AddComment should not return an error")
+		time.Sleep(time.Millisecond)
+	}
+
+	page, err := store.GetComments(context.Background(), post.ID, PageArgs{})
+	assert.NoError(t, err, "GetComments should not return an error")
+	assert.Len(t, page.Items, 5, "Should return the default page size")
+	assert.Equal(t, "Comment 1", page.Items[0].Text, "Comments should be sorted by created_at in ascending order")
+	assert.True(t, page.HasNextPage, "Should report a next page")
+	assert.Equal(t, 7, page.TotalCount, "Total count should include all comments")
+
+	after := EncodeCursor(page.Items[4].CreatedAt, page.Items[4].ID)
+	page, err = store.GetComments(context.Background(), post.ID, PageArgs{After: &after})
+	assert.NoError(t, err, "GetComments should not return an error")
+	assert.Len(t, page.Items, 2, "Should return the rest of the comments")
+	assert.Equal(t, "Comment 6", page.Items[0].Text)
+	assert.False(t, page.HasNextPage, "Should not report a next page")
+	assert.True(t, page.HasPreviousPage, "Should report a previous page")
+
+	last := 2
+	before := EncodeCursor(page.Items[0].CreatedAt, page.Items[0].ID)
+	page, err = store.GetComments(context.Background(), post.ID, PageArgs{Last: &last, Before: &before})
+	assert.NoError(t, err, "GetComments should not return an error")
+	assert.Len(t, page.Items, 2, "Should return the last comments before the cursor")
+	assert.Equal(t, "Comment 4", page.Items[0].Text)
+	assert.Equal(t, "Comment 5", page.Items[1].Text)
+	assert.True(t, page.HasPreviousPage, "Should report a previous page")
+}
+
+func TestInMemoryUpdateAndDeletePost(t *testing.T) {
+	store := NewStorageInMemory()
+	post, _ := store.CreatePost(context.Background(), &models.Post{Title: "Test Post", Content: "Test text", AuthorID: "user-1", AllowComments: true})
+	comment, _ := store.AddComment(context.Background(), &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Test comment"})
+
+	title := "Updated title"
+	updated, err := store.UpdatePost(context.Background(), post.ID, &title, nil)
+	assert.NoError(t, err, "UpdatePost should not return an error")
+	assert.Equal(t, title, updated.Title, "Post title should be updated")
+	assert.Equal(t, "Test text", updated.Content, "Post content should be kept")
+	assert.NotNil(t, updated.UpdatedAt, "Post update time should be set")
+
+	err = store.DeletePost(context.Background(), post.ID)
+	assert.NoError(t, err, "DeletePost should not return an error")
+
+	_, err = store.GetPostByID(context.Background(), post.ID)
+	assert.Error(t, err, "Deleted post should not be found")
+	_, err = store.GetCommentByID(context.Background(), comment.ID)
+	assert.Error(t, err, "Comments of a deleted post should be deleted")
+
+	err = store.DeletePost(context.Background(), post.ID)
+	assert.Error(t, err, "Deleting a missing post should fail")
+}
+
+func TestInMemoryUpdateAndDeleteComment(t *testing.T) {
+	store := NewStorageInMemory()
+	post, _ := store.CreatePost(context.Background(), &models.Post{Title: "Test Post", AuthorID: "user-1", AllowComments: true})
+	parent, _ := store.AddComment(context.Background(), &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Parent"})
+	reply, _ := store.AddComment(context.Background(), &models.Comment{PostID: post.ID, ParentID: &parent.ID, AuthorID: "user-3", Text: "Reply"})
+
+	updated, err := store.UpdateComment(context.Background(), reply.ID, "Edited reply")
+	assert.NoError(t, err, "UpdateComment should not return an error")
+	assert.Equal(t, "Edited reply", updated.Text, "Comment text should be updated")
+	assert.NotNil(t, updated.UpdatedAt, "Comment update time should be set")
+
+	_, err = store.UpdateComment(context.Background(), reply.ID, strings.Repeat("a", limits.MaxTextLength+1))
+	assert.Error(t, err, "UpdateComment should reject too long text")
+
+	err = store.DeleteComment(context.Background(), parent.ID)
+	assert.NoError(t, err, "DeleteComment should not return an error")
+
+	tombstone, err := store.GetCommentByID(context.Background(), parent.ID)
+	assert.NoError(t, err, "Comment with replies should be kept as a tombstone")
+	assert.True(t, tombstone.Deleted, "Tombstone should be marked as deleted")
+	assert.Equal(t, deletedText, tombstone.Text, "Tombstone text should be replaced")
+
+	_, err = store.UpdateComment(context.Background(), parent.ID, "Resurrected")
+	assert.Error(t, err, "Tombstones should not be editable")
+
+	err = store.DeleteComment(context.Background(), reply.ID)
+	assert.NoError(t, err, "DeleteComment should not return an error")
+
+	_, err = store.GetCommentByID(context.Background(), reply.ID)
+	assert.Error(t, err, "Leaf comment should be removed")
+}
+
+func TestInMemorySetCommentsAllowed(t *testing.T) {
+	store := NewStorageInMemory()
+	post, _ := store.CreatePost(context.Background(), &models.Post{Title: "Test Post", AuthorID: "user-1", AllowComments: true})
+
+	locked, err := store.SetCommentsAllowed(context.Background(), post.ID, false)
+	assert.NoError(t, err, "SetCommentsAllowed should not return an error")
+	assert.False(t, locked.AllowComments, "Comments should be locked")
+
+	_, err = store.AddComment(context.Background(), &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Test comment"})
+	assert.ErrorIs(t, err, ErrCommentsDisabled, "AddComment should reject comments on a locked post")
+
+	_, err = store.SetCommentsAllowed(context.Background(), post.ID, true)
+	assert.NoError(t, err, "SetCommentsAllowed should not return an error")
+
+	_, err = store.AddComment(context.Background(), &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Test comment"})
+	assert.NoError(t, err, "AddComment should accept comments on an unlocked post")
+
+	_, err = store.SetCommentsAllowed(context.Background(), "post-unknown", false)
+	assert.Error(t, err, "SetCommentsAllowed should fail for an unknown post")
+}
+
+func TestInMemoryCancelledContext(t *testing.T) {
+	store := NewStorageInMemory()
+	post, err := store.CreatePost(context.Background(), &models.Post{Title: "Post", AuthorID: "user-1", AllowComments: true})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = store.GetPosts(ctx, PageArgs{})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Comment"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = store.DeletePost(ctx, post.ID)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Nothing was written by the cancelled calls.
+	comments, err := store.GetComments(context.Background(), post.ID, PageArgs{})
+	assert.NoError(t, err)
+	assert.Empty(t, comments.Items)
+
+	_, err = store.GetPostByID(context.Background(), post.ID)
+	assert.NoError(t, err)
+}
+
+func TestInMemorySetLimits(t *testing.T) {
+	SetLimits(Limits{PostsPageSize: 2, CommentsPageSize: 1, MaxTextLength: 5})
+	defer SetLimits(DefaultLimits)
+
+	ctx := context.Background()
+	store := NewStorageInMemory()
+	for i := 0; i < 3; i++ {
+		_, err := store.CreatePost(ctx, &models.Post{Title: "Post", AuthorID: "user-1", AllowComments: true, CreatedAt: time.Now()})
+		require.NoError(t, err)
+	}
+	posts, err := store.GetPosts(ctx, PageArgs{})
+	require.NoError(t, err)
+	assert.Len(t, posts.Items, 2)
+
+	_, err = store.AddComment(ctx, &models.Comment{PostID: posts.Items[0].ID, AuthorID: "user-2", Text: "too long"})
+	assert.ErrorIs(t, err, ErrTextTooLong)
+	assert.ErrorContains(t, err, "exceeds 5 characters")
+
+	assert.Error(t, Limits{PostsPageSize: 0, CommentsPageSize: 1, MaxTextLength: 1}.Validate())
+}
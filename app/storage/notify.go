@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"ozontz/app/models"
+	"ozontz/app/pubsub"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	commentAddedChannel  = "comment_added"
+	listenerMinReconnect = time.Second
+	listenerMaxReconnect = time.Minute
+	listenerPingInterval = 90 * time.Second
+)
+
+// resumeBatchSize is the number of missed comments read per query when
+// catching up after a reconnect.
+var resumeBatchSize = 100
+
+type commentNotification struct {
+	ID     string `json:"id"`
+	PostID string `json:"post_id"`
+	Seq    int64  `json:"seq"`
+}
+
+// PostgresBroker delivers comments inserted by any instance sharing the
+// database to local subscribers. Publish is a no-op because the
+// comments_notify_added trigger already emits a NOTIFY for every insert,
+// including the ones made through this instance.
+type PostgresBroker struct {
+	*pubsub.Hub
+
+	store    *PostgresStorage
+	listener *pq.Listener
+
+	// lastSeq is the seq of the newest comment seen, the point catching up
+	// resumes from.
+	lastSeq int64
+	// replayedSeq is the seq of the newest comment sent while catching up.
+	// Notifications for it and older comments were delivered by the
+	// catch-up already.
+	replayedSeq int64
+}
+
+func NewPostgresBroker(dsn string, store *PostgresStorage) *PostgresBroker {
+	return &PostgresBroker{
+		Hub:      pubsub.NewHub(),
+		store:    store,
+		listener: pq.NewListener(dsn, listenerMinReconnect, listenerMaxReconnect, logListenerEvent),
+	}
+}
+
+func (b *PostgresBroker) Publish(comment *models.Comment) {}
+
+func (b *PostgresBroker) Listen(ctx context.Context) error {
+	defer b.listener.Close()
+
+	if err := b.listener.Listen(commentAddedChannel); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", commentAddedChannel, err)
+	}
+	if err := b.seed(ctx); err != nil {
+		return fmt.Errorf("failed to load the latest comment: %w", err)
+	}
+
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-b.listener.Notify:
+			if n == nil {
+				// The connection was re-established and everything sent while it
+				// was down is lost, so catch up from the last comment we saw.
+				if err := b.resume(ctx); err != nil {
+					slog.ErrorContext(ctx, "Failed to resume comment notifications", "error", err)
+				}
+				continue
+			}
+			b.forward(ctx, n.Extra)
+		case <-ticker.C:
+			go b.listener.Ping()
+		}
+	}
+}
+
+func (b *PostgresBroker) forward(ctx context.Context, payload string) {
+	var n commentNotification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		slog.WarnContext(ctx, "Invalid notification payload", "channel", commentAddedChannel, "payload", payload, "error", err)
+		return
+	}
+
+	if n.Seq <= b.replayedSeq {
+		return
+	}
+	b.markSeen(n.Seq)
+
+	if !b.HasSubscribers(n.PostID) {
+		return
+	}
+
+	comment, err := b.store.GetCommentByID(ctx, n.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load comment", "comment_id", n.ID, "error", err)
+		return
+	}
+	b.Hub.Publish(comment)
+}
+
+// seed starts catching up from the newest comment in the database. seq is
+// assigned by the database, so the clocks of the instances writing comments
+// don't matter.
+func (b *PostgresBroker) seed(ctx context.Context) error {
+	query := `SELECT COALESCE(MAX(seq), 0) FROM comments`
+
+	return b.store.db.QueryRowContext(ctx, query).Scan(&b.lastSeq)
+}
+
+// resume sends the comments of subscribed posts added after the last one
+// seen, reading them in batches of resumeBatchSize.
+func (b *PostgresBroker) resume(ctx context.Context) error {
+	postIds := b.Topics()
+	if len(postIds) == 0 {
+		return b.seed(ctx)
+	}
+
+	query := `
+        SELECT ` + commentColumns + `, seq
+        FROM comments
+        WHERE post_id = ANY($1) AND seq > $2
+        ORDER BY seq ASC
+        LIMIT $3
+    `
+
+	for {
+		rows, err := b.store.db.QueryContext(ctx, query, pq.Array(postIds), b.lastSeq, resumeBatchSize)
+		if err != nil {
+			return err
+		}
+		var count int
+		for rows.Next() {
+			var seq int64
+			comment, err := scanComment(seqScanner{rows, &seq})
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			count++
+			b.markSeen(seq)
+			b.replayedSeq = seq
+			b.Hub.Publish(comment)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if count < resumeBatchSize {
+			return nil
+		}
+	}
+}
+
+func (b *PostgresBroker) markSeen(seq int64) {
+	if seq > b.lastSeq {
+		b.lastSeq = seq
+	}
+}
+
+// seqScanner reads the seq column selected after the comment columns.
+type seqScanner struct {
+	row rowScanner
+	seq *int64
+}
+
+func (s seqScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.seq)...)
+}
+
+func logListenerEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		slog.Warn("Comment listener disconnected", "error", err)
+	case pq.ListenerEventReconnected:
+		slog.Info("Comment listener reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		slog.Error("Comment listener failed to reconnect", "error", err)
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPageSize is the largest page a connection returns, larger page sizes
+// are clamped to it.
+const MaxPageSize = 100
+
+type PageArgs struct {
+	First  *int
+	After  *string
+	Last   *int
+	Before *string
+}
+
+type Page[T any] struct {
+	Items           []T
+	HasNextPage     bool
+	HasPreviousPage bool
+	TotalCount      int
+}
+
+// Cursor is the decoded form of an opaque page cursor. Lists are ordered by
+// (CreatedAt, ID) so a cursor pins an exact position even when several rows
+// share a timestamp.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func EncodeCursor(createdAt time.Time, id string) string {
+	raw := strconv.FormatInt(createdAt.UnixNano(), 10) + ":" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(cursor string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found || id == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	ts, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{CreatedAt: time.Unix(0, ts).UTC(), ID: id}, nil
+}
+
+func (c Cursor) less(other Cursor) bool {
+	if !c.CreatedAt.Equal(other.CreatedAt) {
+		return c.CreatedAt.Before(other.CreatedAt)
+	}
+	return c.ID < other.ID
+}
+
+// pageQuery is a validated PageArgs: a direction, a size and the decoded
+// cursors bounding the page.
+type pageQuery struct {
+	backward bool
+	limit    int
+	after    *Cursor
+	before   *Cursor
+}
+
+func newPageQuery(args PageArgs, defaultSize int) (pageQuery, error) {
+	if args.First != nil && args.Last != nil {
+		return pageQuery{}, newError(ErrInvalidInput, "first and last cannot be used together")
+	}
+
+	q := pageQuery{limit: defaultSize}
+	if args.First != nil {
+		q.limit = *args.First
+	}
+	if args.Last != nil {
+		q.backward = true
+		q.limit = *args.Last
+	}
+	if q.limit < 0 {
+		return pageQuery{}, newError(ErrInvalidInput, "page size must not be negative")
+	}
+	if q.limit > MaxPageSize {
+		q.limit = MaxPageSize
+	}
+
+	if args.After != nil {
+		c, err := DecodeCursor(*args.After)
+		if err != nil {
+			return pageQuery{}, err
+		}
+		q.after = &c
+	}
+	if args.Before != nil {
+		c, err := DecodeCursor(*args.Before)
+		if err != nil {
+			return pageQuery{}, err
+		}
+		q.before = &c
+	}
+
+	return q, nil
+}
+
+// paginate cuts a page out of items, which must be sorted oldest first.
+// desc reports whether the list is presented newest first. The cursors are
+// located by binary search, so the cost does not grow with len(items).
+func paginate[T any](items []T, key func(T) Cursor, desc bool, q pageQuery) *Page[T] {
+	// Bounds of the window in ascending order; a cursor excludes itself.
+	lower, upper := q.after, q.before
+	if desc {
+		lower, upper = upper, lower
+	}
+	lo, hi := 0, len(items)
+	if lower != nil {
+		lo = sort.Search(len(items), func(i int) bool {
+			return lower.less(key(items[i]))
+		})
+	}
+	if upper != nil {
+		hi = sort.Search(len(items), func(i int) bool {
+			return !key(items[i]).less(*upper)
+		})
+	}
+	window := items[lo:max(lo, hi)]
+
+	page := &Page[T]{TotalCount: len(items)}
+	more := len(window) > q.limit
+	// Newest-first lists and backward pages both take the window from its
+	// end, unless both apply.
+	fromEnd := desc != q.backward
+	if more {
+		if fromEnd {
+			window = window[len(window)-q.limit:]
+		} else {
+			window = window[:q.limit]
+		}
+	}
+
+	// The index keeps changing after the lock is released, so the page gets
+	// its own copy.
+	page.Items = slices.Clone(window)
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if desc {
+		slices.Reverse(page.Items)
+	}
+
+	if q.backward {
+		page.HasNextPage = q.before != nil
+		page.HasPreviousPage = more
+	} else {
+		page.HasPreviousPage = q.after != nil
+		page.HasNextPage = more
+	}
+
+	return page
+}
+
+// keysetQuery appends the cursor bounds, ordering and limit of q to a SQL
+// query over a table with created_at and id columns. It fetches one extra row
+// so finishPage can tell whether another page follows.
+func keysetQuery(query string, args []interface{}, q pageQuery, desc bool) (string, []interface{}) {
+	afterOp, beforeOp := ">", "<"
+	if desc {
+		afterOp, beforeOp = "<", ">"
+	}
+
+	if q.after != nil {
+		query += fmt.Sprintf(" AND (created_at, id) %s ($%d, $%d)", afterOp, len(args)+1, len(args)+2)
+		args = append(args, q.after.CreatedAt, q.after.ID)
+	}
+	if q.before != nil {
+		query += fmt.Sprintf(" AND (created_at, id) %s ($%d, $%d)", beforeOp, len(args)+1, len(args)+2)
+		args = append(args, q.before.CreatedAt, q.before.ID)
+	}
+
+	order := "ASC"
+	if desc != q.backward {
+		order = "DESC"
+	}
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT $%d", order, order, len(args)+1)
+	args = append(args, q.limit+1)
+
+	return query, args
+}
+
+// finishPage turns the rows fetched by a keysetQuery into a page in list
+// order.
+func finishPage[T any](items []T, q pageQuery, totalCount int) *Page[T] {
+	page := &Page[T]{TotalCount: totalCount}
+
+	more := len(items) > q.limit
+	if more {
+		items = items[:q.limit]
+	}
+
+	if q.backward {
+		slices.Reverse(items)
+		page.HasPreviousPage = more
+		page.HasNextPage = q.before != nil
+	} else {
+		page.HasNextPage = more
+		page.HasPreviousPage = q.after != nil
+	}
+	page.Items = items
+
+	return page
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2025, 2, 10, 20, 24, 25, 835852000, time.UTC)
+
+	cursor, err := DecodeCursor(EncodeCursor(createdAt, "com-1"))
+	require.NoError(t, err, "DecodeCursor should accept an encoded cursor")
+	assert.True(t, createdAt.Equal(cursor.CreatedAt), "Cursor time mismatch")
+	assert.Equal(t, "com-1", cursor.ID, "Cursor ID mismatch")
+
+	for _, invalid := range []string{"", "cur-com-1", EncodeCursor(createdAt, "")} {
+		_, err := DecodeCursor(invalid)
+		assert.Error(t, err, "DecodeCursor should reject %q", invalid)
+	}
+}
+
+func TestNewPageQuery(t *testing.T) {
+	one, negative, huge := 1, -1, MaxPageSize+1
+
+	q, err := newPageQuery(PageArgs{}, DefaultLimits.CommentsPageSize)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultLimits.CommentsPageSize, q.limit, "Should fall back to the default page size")
+	assert.False(t, q.backward)
+
+	q, err = newPageQuery(PageArgs{Last: &one}, DefaultLimits.CommentsPageSize)
+	require.NoError(t, err)
+	assert.Equal(t, 1, q.limit)
+	assert.True(t, q.backward, "last should paginate backwards")
+
+	q, err = newPageQuery(PageArgs{First: &huge}, DefaultLimits.CommentsPageSize)
+	require.NoError(t, err)
+	assert.Equal(t, MaxPageSize, q.limit, "Page size should be capped")
+
+	_, err = newPageQuery(PageArgs{First: &one, Last: &one}, DefaultLimits.CommentsPageSize)
+	assert.Error(t, err, "first and last should be mutually exclusive")
+
+	_, err = newPageQuery(PageArgs{First: &negative}, DefaultLimits.CommentsPageSize)
+	assert.Error(t, err, "Negative page size should be rejected")
+}
@@ -5,189 +5,83 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
-	"ozontz/app/models"
+	"log/slog"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
+const uniqueViolation = "23505"
+
 type PostgresStorage struct {
-	db *sql.DB
+	sqlStorage
 }
 
 func NewStoragePostgres(db *sql.DB) *PostgresStorage {
-	return &PostgresStorage{db: db}
+	return &PostgresStorage{newSQLStorage(db, postgresDialect)}
 }
 
-func (s *PostgresStorage) GetPosts(ctx context.Context) ([]*models.Post, error) {
-	query := `
-        SELECT id, title, content, author_id, allow_comments, created_at
+var postgresDialect = sqlDialect{
+	system: semconv.DBSystemPostgreSQL,
+	// The post row is share-locked so a concurrent setCommentsAllowed(false)
+	// cannot slip in between the check and the insert. A reply is only
+	// inserted when its parent is in the same post and not nested too deeply;
+	// comments_parent_id_fkey guards against the parent being deleted meanwhile.
+	addComment: `
+        INSERT INTO comments (id, post_id, parent_id, author_id, text, created_at, depth)
+        SELECT $1::varchar, $2::varchar, $3::varchar, $4::varchar, $5::text, $6::timestamp,
+            COALESCE((SELECT depth + 1 FROM comments WHERE id = $3 AND post_id = $2), 1)
         FROM posts
-        WHERE true
-    `
-
-	args := []interface{}{}
-
-	query += " ORDER BY created_at DESC"
-	if postsCount > 0 {
-		query += " LIMIT $" + strconv.Itoa(len(args)+1)
-		args = append(args, postsCount)
-	}
-
-	rows, err := s.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var posts []*models.Post
-	for rows.Next() {
-		post := &models.Post{}
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.AllowComments, &post.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		posts = append(posts, post)
-	}
-
-	return posts, nil
+        WHERE id = $2 AND allow_comments
+            AND ($3::varchar IS NULL OR EXISTS (
+                SELECT 1 FROM comments WHERE id = $3 AND post_id = $2 AND depth < $7
+            ))
+        FOR SHARE
+        RETURNING ` + commentColumns + `
+    `,
+	// Locking the row makes a concurrent reply wait on comments_parent_id_fkey
+	// until the deleting transaction ends, so it either sees the reply or fails.
+	lockComment: "SELECT id FROM comments WHERE id = $1 FOR UPDATE",
+	latestComments: `
+        SELECT DISTINCT ON (post_id) ` + commentColumns + `
+        FROM comments
+        WHERE post_id = ANY($1) AND parent_id IS NULL
+        ORDER BY post_id, created_at DESC, id DESC
+    `,
+	idList:      func(ids []string) interface{} { return pq.Array(ids) },
+	insertError: postgresInsertError,
 }
 
-func (s *PostgresStorage) GetPostByID(ctx context.Context, id string) (*models.Post, error) {
-	row := s.db.QueryRowContext(ctx, "SELECT id, title, content, author_id, allow_comments, created_at FROM posts WHERE id = $1", id)
-
-	post := &models.Post{}
-	err := row.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.AllowComments, &post.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("post not found")
-		}
-		return nil, err
+func postgresInsertError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Constraint == "comments_parent_id_fkey" {
+		return ErrParentNotFound
 	}
-
-	return post, nil
+	return conflictError(err)
 }
 
-func (s *PostgresStorage) CreatePost(ctx context.Context, post *models.Post) (*models.Post, error) {
-	query := `
-        INSERT INTO posts (id, title, content, author_id, allow_comments, created_at)
-        VALUES ($1, $2, $3, $4, $5, $6)
-        RETURNING id, title, content, author_id, allow_comments, created_at
-    `
-
-	post.ID = generateId("post-")
-	post.CreatedAt = time.Now().UTC()
-
-	err := s.db.QueryRowContext(ctx, query, post.ID, post.Title, post.Content, post.AuthorID, post.AllowComments, post.CreatedAt).Scan(
-		&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.AllowComments, &post.CreatedAt,
-	)
-	if err != nil {
-		return nil, err
+// conflictError maps unique violations, such as two instances generating the
+// same ID, to ErrConflict.
+func conflictError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return newError(ErrConflict, "a row with the same key already exists")
 	}
-
-	return post, nil
+	return err
 }
 
-func (s *PostgresStorage) AddComment(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
-	if len(comment.Text) > 2000 {
-		return nil, errors.New("comment text exceeds 2000 characters")
+// HealthCheck pings the database and checks that its schema is migrated.
+// It bypasses statement tracing, as it runs on every readiness probe.
+func (s *PostgresStorage) HealthCheck(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
 	}
-
-	query := `
-        INSERT INTO comments (id, post_id, parent_id, author_id, text, created_at)
-        VALUES ($1, $2, $3, $4, $5, $6)
-        RETURNING id, post_id, parent_id, author_id, text, created_at
-    `
-
-	comment.ID = generateId("com-")
-	comment.CreatedAt = time.Now().UTC()
-
-	var parentId sql.NullString
-	if comment.ParentID != nil {
-		parentId.String = *comment.ParentID
-		parentId.Valid = true
-	}
-
-	err := s.db.QueryRowContext(ctx, query, comment.ID, comment.PostID, parentId, comment.AuthorID, comment.Text, comment.CreatedAt).Scan(
-		&comment.ID, &comment.PostID, &comment.ParentID, &comment.AuthorID, &comment.Text, &comment.CreatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return comment, nil
-}
-
-func (s *PostgresStorage) GetComments(ctx context.Context, postId string, fromID *string) ([]*models.Comment, error) {
-	query := `
-        SELECT id, post_id, parent_id, author_id, text, created_at
-        FROM comments
-        WHERE post_id = $1
-    `
-
-	args := []interface{}{postId}
-
-	if fromID != nil {
-		query += " AND created_at > (SELECT created_at FROM comments WHERE id = $" + strconv.Itoa(len(args)+1) + ")"
-		args = append(args, *fromID)
-	}
-
-	query += " ORDER BY created_at ASC"
-	if commentsCount > 0 {
-		query += " LIMIT $" + strconv.Itoa(len(args)+1)
-		args = append(args, commentsCount)
-	}
-
-	rows, err := s.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var comments []*models.Comment
-	for rows.Next() {
-		comment := &models.Comment{}
-		var parentId sql.NullString
-		err := rows.Scan(&comment.ID, &comment.PostID, &parentId, &comment.AuthorID, &comment.Text, &comment.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		if parentId.Valid {
-			comment.ParentID = &parentId.String
-		}
-		comments = append(comments, comment)
-	}
-
-	return comments, nil
-}
-
-func (s *PostgresStorage) GetLatestComment(ctx context.Context, postId string) (*models.Comment, error) {
-	query := `
-        SELECT id, post_id, parent_id, author_id, text, created_at
-        FROM comments
-        WHERE post_id = $1 AND parent_id IS NULL
-        ORDER BY created_at DESC
-        LIMIT 1
-    `
-
-	row := s.db.QueryRowContext(ctx, query, postId)
-
-	comment := &models.Comment{}
-	err := row.Scan(&comment.ID, &comment.PostID, &comment.ParentID, &comment.AuthorID, &comment.Text, &comment.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, err
-	}
-
-	return comment, nil
+	return checkSchemaVersion(ctx, s.db.DB, getMigrationDir())
 }
 
 func (s *PostgresStorage) ApplyMigrations(migrationDir string) error {
@@ -196,7 +90,7 @@ func (s *PostgresStorage) ApplyMigrations(migrationDir string) error {
 		migrationDir = "file://" + migrationDir
 	}
 
-	dbDriver, err := postgres.WithInstance(s.db, &postgres.Config{})
+	dbDriver, err := postgres.WithInstance(s.db.DB, &postgres.Config{})
 	if err != nil {
 		return fmt.Errorf("failed to initialize Postgres driver: %w", err)
 	}
@@ -214,10 +108,6 @@ func (s *PostgresStorage) ApplyMigrations(migrationDir string) error {
 		return fmt.Errorf("failed to apply migrations: %w", err)
 	}
 
-	log.Println("Migrations applied successfully")
+	slog.Info("Migrations applied successfully")
 	return nil
 }
-
-func generateId(contentType string) string {
-	return contentType + strconv.FormatInt(time.Now().UnixNano(), 10)
-}
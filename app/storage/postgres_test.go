@@ -16,6 +16,11 @@ import (
 )
 
 func setupTestDB(t *testing.T) (*sql.DB, func()) {
+	db, _, teardown := setupTestDBWithDSN(t)
+	return db, teardown
+}
+
+func setupTestDBWithDSN(t *testing.T) (*sql.DB, string, func()) {
 	ctx := context.Background()
 
 	req := testcontainers.ContainerRequest{
@@ -57,7 +62,7 @@ func setupTestDB(t *testing.T) (*sql.DB, func()) {
 		container.Terminate(ctx)
 	}
 
-	return db, teardown
+	return db, dsn, teardown
 }
 
 func TestCreatePost(t *testing.T) {
@@ -179,3 +184,324 @@ func TestGetLatestComment(t *testing.T) {
 	require.NoError(t, err, "GetLatestComment failed")
 	assert.Nil(t, latestComment.ParentID, "Comment not parent")
 }
+
+func TestPostgresBrokerForwardsComments(t *testing.T) {
+	db, dsn, teardown := setupTestDBWithDSN(t)
+	defer teardown()
+
+	store := NewStoragePostgres(db)
+	broker := NewPostgresBroker(dsn, store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go broker.Listen(ctx)
+
+	post, err := store.CreatePost(context.Background(), &models.Post{
+		Title:         "Test Post",
+		Content:       "Test text",
+		AuthorID:      "user-1",
+		AllowComments: true,
+	})
+	require.NoError(t, err, "CreatePost failed")
+
+	events, unsubscribe := broker.Subscribe(post.ID)
+	defer unsubscribe()
+
+	// Give the listener time to issue LISTEN before the insert.
+	time.Sleep(500 * time.Millisecond)
+
+	comment, err := NewStoragePostgres(db).AddComment(context.Background(), &models.Comment{
+		PostID:   post.ID,
+		AuthorID: "user-2",
+		Text:     "Test comment",
+	})
+	require.NoError(t, err, "AddComment failed")
+
+	select {
+	case received := <-events:
+		assert.Equal(t, comment.ID, received.ID, "Comment ID mismatch")
+		assert.Equal(t, comment.Text, received.Text, "Comment text mismatch")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Comment notification was not delivered")
+	}
+}
+
+func TestPostgresBrokerResume(t *testing.T) {
+	db, dsn, teardown := setupTestDBWithDSN(t)
+	defer teardown()
+
+	defer func(size int) { resumeBatchSize = size }(resumeBatchSize)
+	resumeBatchSize = 2
+
+	ctx := context.Background()
+	store := NewStoragePostgres(db)
+	broker := NewPostgresBroker(dsn, store)
+	defer broker.listener.Close()
+
+	post, err := store.CreatePost(ctx, &models.Post{Title: "Test Post", Content: "Test text", AuthorID: "user-1", AllowComments: true})
+	require.NoError(t, err, "CreatePost failed")
+	other, err := store.CreatePost(ctx, &models.Post{Title: "Other Post", Content: "Test text", AuthorID: "user-1", AllowComments: true})
+	require.NoError(t, err, "CreatePost failed")
+	_, err = store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Before"})
+	require.NoError(t, err, "AddComment failed")
+	require.NoError(t, broker.seed(ctx))
+
+	events, unsubscribe := broker.Subscribe(post.ID)
+	defer unsubscribe()
+
+	var missed []*models.Comment
+	for i := 0; i < 3; i++ {
+		comment, err := store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: fmt.Sprintf("Missed %d", i)})
+		require.NoError(t, err, "AddComment failed")
+		missed = append(missed, comment)
+		_, err = store.AddComment(ctx, &models.Comment{PostID: other.ID, AuthorID: "user-2", Text: "Unsubscribed"})
+		require.NoError(t, err, "AddComment failed")
+	}
+
+	require.NoError(t, broker.resume(ctx))
+	for _, comment := range missed {
+		select {
+		case received := <-events:
+			assert.Equal(t, comment.ID, received.ID, "Missed comments should be sent in order")
+		default:
+			t.Fatalf("Missed comment %s was not sent", comment.ID)
+		}
+	}
+
+	last := missed[len(missed)-1]
+	var seq int64
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT seq FROM comments WHERE id = $1", last.ID).Scan(&seq))
+	broker.forward(ctx, fmt.Sprintf(`{"id": %q, "post_id": %q, "seq": %d}`, last.ID, last.PostID, seq))
+	select {
+	case received := <-events:
+		t.Fatalf("Comment %s was sent twice", received.ID)
+	default:
+	}
+}
+
+func TestGetCommentThread(t *testing.T) {
+	db, teardown := setupTestDB(t)
+	defer teardown()
+
+	store := NewStoragePostgres(db)
+
+	post, err := store.CreatePost(context.Background(), &models.Post{
+		Title:         "Test Post",
+		Content:       "Test text",
+		AuthorID:      "user-1",
+		AllowComments: true,
+	})
+	require.NoError(t, err, "CreatePost failed")
+
+	var parentID *string
+	for i := 1; i <= 4; i++ {
+		comment, err := store.AddComment(context.Background(), &models.Comment{
+			PostID:   post.ID,
+			ParentID: parentID,
+			AuthorID: "user-2",
+			Text:     fmt.Sprintf("Level %d", i),
+		})
+		require.NoError(t, err, "AddComment failed")
+		parentID = &comment.ID
+		time.Sleep(time.Millisecond)
+	}
+
+	thread, err := store.GetCommentThread(context.Background(), post.ID, 2)
+	require.NoError(t, err, "GetCommentThread failed")
+	require.Len(t, thread, 2, "Thread depth mismatch")
+	assert.Equal(t, "Level 1", thread[0].Text)
+	assert.Equal(t, "Level 2", thread[1].Text)
+
+	replies, err := store.GetReplies(context.Background(), thread[0].ID, PageArgs{})
+	require.NoError(t, err, "GetReplies failed")
+	require.Len(t, replies.Items, 1, "Replies count mismatch")
+	assert.Equal(t, thread[1].ID, replies.Items[0].ID, "Reply ID mismatch")
+}
+
+func TestGetCommentsPagination(t *testing.T) {
+	db, teardown := setupTestDB(t)
+	defer teardown()
+
+	store := NewStoragePostgres(db)
+
+	post, err := store.CreatePost(context.Background(), &models.Post{
+		Title:         "Test Post",
+		Content:       "Test text",
+		AuthorID:      "user-1",
+		AllowComments: true,
+	})
+	require.NoError(t, err, "CreatePost failed")
+
+	for i := 1; i <= 7; i++ {
+		_, err := store.AddComment(context.Background(), &models.Comment{
+			PostID:   post.ID,
+			AuthorID: "user-2",
+			Text:     fmt.Sprintf("Comment %d", i),
+		})
+		require.NoError(t, err, "AddComment failed")
+		time.Sleep(time.Millisecond)
+	}
+
+	page, err := store.GetComments(context.Background(), post.ID, PageArgs{})
+	require.NoError(t, err, "GetComments failed")
+	require.Len(t, page.Items, 5, "Default page size mismatch")
+	assert.Equal(t, "Comment 1", page.Items[0].Text, "Comments not in ascending order")
+	assert.True(t, page.HasNextPage, "Next page not reported")
+	assert.Equal(t, 7, page.TotalCount, "Total count mismatch")
+
+	after := EncodeCursor(page.Items[4].CreatedAt, page.Items[4].ID)
+	page, err = store.GetComments(context.Background(), post.ID, PageArgs{After: &after})
+	require.NoError(t, err, "GetComments failed")
+	require.Len(t, page.Items, 2, "Second page size mismatch")
+	assert.Equal(t, "Comment 6", page.Items[0].Text)
+	assert.False(t, page.HasNextPage, "Unexpected next page")
+
+	last := 2
+	before := EncodeCursor(page.Items[0].CreatedAt, page.Items[0].ID)
+	page, err = store.GetComments(context.Background(), post.ID, PageArgs{Last: &last, Before: &before})
+	require.NoError(t, err, "GetComments failed")
+	require.Len(t, page.Items, 2, "Backward page size mismatch")
+	assert.Equal(t, "Comment 4", page.Items[0].Text)
+	assert.Equal(t, "Comment 5", page.Items[1].Text)
+	assert.True(t, page.HasPreviousPage, "Previous page not reported")
+
+	posts, err := store.GetPosts(context.Background(), PageArgs{})
+	require.NoError(t, err, "GetPosts failed")
+	assert.Equal(t, 1, posts.TotalCount, "Posts total count mismatch")
+}
+
+func TestUpdateAndDeleteComment(t *testing.T) {
+	db, teardown := setupTestDB(t)
+	defer teardown()
+
+	store := NewStoragePostgres(db)
+
+	post, err := store.CreatePost(context.Background(), &models.Post{
+		Title:         "Test Post",
+		Content:       "Test text",
+		AuthorID:      "user-1",
+		AllowComments: true,
+	})
+	require.NoError(t, err, "CreatePost failed")
+
+	title := "Updated title"
+	updatedPost, err := store.UpdatePost(context.Background(), post.ID, &title, nil)
+	require.NoError(t, err, "UpdatePost failed")
+	assert.Equal(t, title, updatedPost.Title, "Post title mismatch")
+	assert.Equal(t, post.Content, updatedPost.Content, "Post content mismatch")
+
+	parent, err := store.AddComment(context.Background(), &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Parent"})
+	require.NoError(t, err, "AddComment failed")
+	reply, err := store.AddComment(context.Background(), &models.Comment{PostID: post.ID, ParentID: &parent.ID, AuthorID: "user-3", Text: "Reply"})
+	require.NoError(t, err, "AddComment failed")
+
+	updated, err := store.UpdateComment(context.Background(), reply.ID, "Edited reply")
+	require.NoError(t, err, "UpdateComment failed")
+	assert.Equal(t, "Edited reply", updated.Text, "Comment text mismatch")
+	assert.NotNil(t, updated.UpdatedAt, "Comment update time not set")
+
+	require.NoError(t, store.DeleteComment(context.Background(), parent.ID), "DeleteComment failed")
+
+	tombstone, err := store.GetCommentByID(context.Background(), parent.ID)
+	require.NoError(t, err, "Tombstone not found")
+	assert.True(t, tombstone.Deleted, "Tombstone not marked as deleted")
+	assert.Equal(t, deletedText, tombstone.Text, "Tombstone text mismatch")
+
+	require.NoError(t, store.DeleteComment(context.Background(), reply.ID), "DeleteComment failed")
+	_, err = store.GetCommentByID(context.Background(), reply.ID)
+	assert.Error(t, err, "Leaf comment not removed")
+
+	require.NoError(t, store.DeletePost(context.Background(), post.ID), "DeletePost failed")
+	_, err = store.GetCommentByID(context.Background(), parent.ID)
+	assert.Error(t, err, "Comments not removed with the post")
+}
+
+func TestSetCommentsAllowed(t *testing.T) {
+	db, teardown := setupTestDB(t)
+	defer teardown()
+
+	store := NewStoragePostgres(db)
+
+	post, err := store.CreatePost(context.Background(), &models.Post{
+		Title:         "Test Post",
+		Content:       "Test text",
+		AuthorID:      "user-1",
+		AllowComments: true,
+	})
+	require.NoError(t, err, "CreatePost failed")
+
+	locked, err := store.SetCommentsAllowed(context.Background(), post.ID, false)
+	require.NoError(t, err, "SetCommentsAllowed failed")
+	assert.False(t, locked.AllowComments, "Comments not locked")
+
+	_, err = store.AddComment(context.Background(), &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Test comment"})
+	assert.ErrorIs(t, err, ErrCommentsDisabled, "Comment accepted on a locked post")
+
+	_, err = store.SetCommentsAllowed(context.Background(), post.ID, true)
+	require.NoError(t, err, "SetCommentsAllowed failed")
+
+	_, err = store.AddComment(context.Background(), &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Test comment"})
+	assert.NoError(t, err, "Comment rejected on an unlocked post")
+
+	_, err = store.AddComment(context.Background(), &models.Comment{PostID: "post-unknown", AuthorID: "user-2", Text: "Test comment"})
+	assert.Error(t, err, "Comment accepted for an unknown post")
+}
+
+func TestPostgresCancelledContext(t *testing.T) {
+	db, teardown := setupTestDB(t)
+	defer teardown()
+
+	store := NewStoragePostgres(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := store.GetPosts(ctx, PageArgs{})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = store.CreatePost(ctx, &models.Post{Title: "Post", AuthorID: "user-1", AllowComments: true})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPostgresDeadlineCancelsQuery(t *testing.T) {
+	db, teardown := setupTestDB(t)
+	defer teardown()
+
+	store := NewStoragePostgres(db)
+
+	// Hold an exclusive lock on posts so the read below blocks until its
+	// deadline cancels it.
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.Exec("LOCK TABLE posts IN ACCESS EXCLUSIVE MODE")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = store.GetPosts(ctx, PageArgs{})
+	assert.Error(t, err)
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestPostgresConfigConnString(t *testing.T) {
+	dsn, err := PostgresConfig{DSN: "host=db sslmode=require", Host: "ignored"}.ConnString()
+	require.NoError(t, err)
+	assert.Equal(t, "host=db sslmode=require", dsn)
+
+	cfg := DefaultPostgresConfig
+	cfg.Host, cfg.User, cfg.Password, cfg.Name = "db", "ozontz", "p@ss word", "ozontz"
+	dsn, err = cfg.ConnString()
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://ozontz:p%40ss%20word@db:5432/ozontz?sslmode=disable", dsn)
+
+	cfg.SSLMode = "sometimes"
+	_, err = cfg.ConnString()
+	assert.ErrorContains(t, err, `unknown sslmode "sometimes"`)
+
+	_, err = PostgresConfig{Host: "db"}.ConnString()
+	assert.ErrorContains(t, err, "database user, name not set")
+}
@@ -0,0 +1,489 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"ozontz/app/models"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	postColumns    = "id, title, content, author_id, allow_comments, created_at, updated_at"
+	commentColumns = "id, post_id, parent_id, author_id, text, deleted, created_at, updated_at"
+)
+
+// sqlStorage runs the queries PostgresStorage and SQLiteStorage share. The
+// statements the two databases disagree on come from its dialect.
+type sqlStorage struct {
+	db      tracedDB
+	dialect sqlDialect
+}
+
+func newSQLStorage(db *sql.DB, dialect sqlDialect) sqlStorage {
+	return sqlStorage{db: tracedDB{DB: db, system: dialect.system}, dialect: dialect}
+}
+
+// sqlDialect holds the statements and error mapping specific to a database.
+type sqlDialect struct {
+	// system is the db.system attribute of the spans of its statements.
+	system attribute.KeyValue
+	// addComment inserts a comment from the arguments id, post_id,
+	// parent_id, author_id, text, created_at and the maximum depth, unless
+	// the post doesn't allow comments or the parent is missing, in another
+	// post or nested too deeply.
+	addComment string
+	// lockComment selects the comment DeleteComment is about to remove,
+	// locking it where the database has row locks.
+	lockComment string
+	// latestComments selects the newest top-level comment of every post in
+	// the list idList makes of the post IDs.
+	latestComments string
+	idList         func(ids []string) interface{}
+	// insertError maps the driver errors of inserts to storage errors.
+	insertError func(err error) error
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (s *sqlStorage) GetPosts(ctx context.Context, page PageArgs) (*Page[*models.Post], error) {
+	q, err := newPageQuery(page, limits.PostsPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT ` + postColumns + `
+        FROM posts
+        WHERE true
+    `
+
+	query, args := keysetQuery(query, []interface{}{}, q, true)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var totalCount int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts").Scan(&totalCount); err != nil {
+		return nil, err
+	}
+
+	return finishPage(posts, q, totalCount), nil
+}
+
+func (s *sqlStorage) GetPostByID(ctx context.Context, id string) (*models.Post, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+postColumns+" FROM posts WHERE id = $1", id)
+
+	post, err := scanPost(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+
+	return post, nil
+}
+
+func (s *sqlStorage) CreatePost(ctx context.Context, post *models.Post) (*models.Post, error) {
+	query := `
+        INSERT INTO posts (id, title, content, author_id, allow_comments, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING ` + postColumns + `
+    `
+
+	post.ID = newID("post-")
+	post.CreatedAt = time.Now().UTC()
+
+	row := s.db.QueryRowContext(ctx, query, post.ID, post.Title, post.Content, post.AuthorID, post.AllowComments, post.CreatedAt)
+
+	created, err := scanPost(row)
+	if err != nil {
+		return nil, s.dialect.insertError(err)
+	}
+
+	return created, nil
+}
+
+func (s *sqlStorage) UpdatePost(ctx context.Context, id string, title, content *string) (*models.Post, error) {
+	query := `
+        UPDATE posts
+        SET title = COALESCE($2, title), content = COALESCE($3, content), updated_at = $4
+        WHERE id = $1
+        RETURNING ` + postColumns + `
+    `
+
+	row := s.db.QueryRowContext(ctx, query, id, title, content, time.Now().UTC())
+
+	post, err := scanPost(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+
+	return post, nil
+}
+
+func (s *sqlStorage) DeletePost(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM posts WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPostNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlStorage) SetCommentsAllowed(ctx context.Context, postId string, allowed bool) (*models.Post, error) {
+	query := `
+        UPDATE posts
+        SET allow_comments = $2, updated_at = $3
+        WHERE id = $1
+        RETURNING ` + postColumns + `
+    `
+
+	row := s.db.QueryRowContext(ctx, query, postId, allowed, time.Now().UTC())
+
+	post, err := scanPost(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+
+	return post, nil
+}
+
+func (s *sqlStorage) AddComment(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
+	if utf8.RuneCountInString(comment.Text) > limits.MaxTextLength {
+		return nil, errTextTooLong()
+	}
+
+	comment.ID = newID("com-")
+	comment.CreatedAt = time.Now().UTC()
+
+	var parentId sql.NullString
+	if comment.ParentID != nil {
+		parentId.String = *comment.ParentID
+		parentId.Valid = true
+	}
+
+	row := s.db.QueryRowContext(ctx, s.dialect.addComment, comment.ID, comment.PostID, parentId, comment.AuthorID, comment.Text, comment.CreatedAt, maxCommentDepth)
+
+	created, err := scanComment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, s.addCommentError(ctx, comment)
+		}
+		return nil, s.dialect.insertError(err)
+	}
+
+	return created, nil
+}
+
+// addCommentError works out which condition stopped AddComment from
+// inserting a row.
+func (s *sqlStorage) addCommentError(ctx context.Context, comment *models.Comment) error {
+	post, err := s.GetPostByID(ctx, comment.PostID)
+	if err != nil {
+		return err
+	}
+	if !post.AllowComments || comment.ParentID == nil {
+		// Without a parent only the post itself can have refused the comment.
+		return ErrCommentsDisabled
+	}
+
+	parent, err := s.GetCommentByID(ctx, *comment.ParentID)
+	if errors.Is(err, ErrCommentNotFound) {
+		return ErrParentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if parent.PostID != comment.PostID {
+		return ErrParentMismatch
+	}
+	return ErrThreadTooDeep
+}
+
+func (s *sqlStorage) UpdateComment(ctx context.Context, id string, text string) (*models.Comment, error) {
+	if utf8.RuneCountInString(text) > limits.MaxTextLength {
+		return nil, errTextTooLong()
+	}
+
+	query := `
+        UPDATE comments
+        SET text = $2, updated_at = $3
+        WHERE id = $1 AND NOT deleted
+        RETURNING ` + commentColumns + `
+    `
+
+	row := s.db.QueryRowContext(ctx, query, id, text, time.Now().UTC())
+
+	comment, err := scanComment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if _, err := s.GetCommentByID(ctx, id); err != nil {
+				return nil, err
+			}
+			return nil, ErrCommentDeleted
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (s *sqlStorage) DeleteComment(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, s.dialect.lockComment, id).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCommentNotFound
+		}
+		return err
+	}
+
+	// Replies keep pointing at a tombstone so the thread stays intact; only
+	// leaf comments are removed for real.
+	tombstone := `
+        UPDATE comments
+        SET text = $2, deleted = TRUE, updated_at = $3
+        WHERE id = $1 AND EXISTS (SELECT 1 FROM comments WHERE parent_id = $1)
+    `
+	result, err := tx.ExecContext(ctx, tombstone, id, deletedText, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		result, err = tx.ExecContext(ctx, "DELETE FROM comments WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		affected, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrCommentNotFound
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStorage) GetComments(ctx context.Context, postId string, page PageArgs) (*Page[*models.Comment], error) {
+	return s.getCommentsPage(ctx, "post_id", postId, page)
+}
+
+func (s *sqlStorage) GetLatestComment(ctx context.Context, postId string) (*models.Comment, error) {
+	query := `
+        SELECT ` + commentColumns + `
+        FROM comments
+        WHERE post_id = $1 AND parent_id IS NULL
+        ORDER BY created_at DESC, id DESC
+        LIMIT 1
+    `
+
+	row := s.db.QueryRowContext(ctx, query, postId)
+
+	comment, err := scanComment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (s *sqlStorage) GetLatestComments(ctx context.Context, postIds []string) (map[string]*models.Comment, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.latestComments, s.dialect.idList(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return latestByPost(comments), nil
+}
+
+func (s *sqlStorage) GetReplies(ctx context.Context, parentId string, page PageArgs) (*Page[*models.Comment], error) {
+	return s.getCommentsPage(ctx, "parent_id", parentId, page)
+}
+
+func (s *sqlStorage) getCommentsPage(ctx context.Context, column, value string, page PageArgs) (*Page[*models.Comment], error) {
+	q, err := newPageQuery(page, limits.CommentsPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT ` + commentColumns + `
+        FROM comments
+        WHERE ` + column + ` = $1
+    `
+
+	query, args := keysetQuery(query, []interface{}{value}, q, false)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalCount int
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE "+column+" = $1", value).Scan(&totalCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return finishPage(comments, q, totalCount), nil
+}
+
+func (s *sqlStorage) GetCommentThread(ctx context.Context, postId string, depth int) ([]*models.Comment, error) {
+	if _, err := s.GetPostByID(ctx, postId); err != nil {
+		return nil, err
+	}
+
+	query := `
+        WITH RECURSIVE thread AS (
+            SELECT ` + commentColumns + `, 1 AS depth
+            FROM comments
+            WHERE post_id = $1 AND parent_id IS NULL
+            UNION ALL
+            SELECT c.id, c.post_id, c.parent_id, c.author_id, c.text, c.deleted, c.created_at, c.updated_at, t.depth + 1
+            FROM comments c
+            JOIN thread t ON c.parent_id = t.id
+            WHERE t.depth < $2
+        )
+        SELECT ` + commentColumns + `
+        FROM thread
+        ORDER BY created_at ASC, id ASC
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, postId, NormalizeDepth(depth))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanComments(rows)
+}
+
+func (s *sqlStorage) GetCommentByID(ctx context.Context, id string) (*models.Comment, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+commentColumns+" FROM comments WHERE id = $1", id)
+
+	comment, err := scanComment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func scanPost(row rowScanner) (*models.Post, error) {
+	post := &models.Post{}
+	var updatedAt sql.NullTime
+	err := row.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.AllowComments, &post.CreatedAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if updatedAt.Valid {
+		post.UpdatedAt = &updatedAt.Time
+	}
+
+	return post, nil
+}
+
+func scanComment(row rowScanner) (*models.Comment, error) {
+	comment := &models.Comment{}
+	var parentId sql.NullString
+	var updatedAt sql.NullTime
+	err := row.Scan(&comment.ID, &comment.PostID, &parentId, &comment.AuthorID, &comment.Text, &comment.Deleted, &comment.CreatedAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if parentId.Valid {
+		comment.ParentID = &parentId.String
+	}
+	if updatedAt.Valid {
+		comment.UpdatedAt = &updatedAt.Time
+	}
+
+	return comment, nil
+}
+
+func latestByPost(comments []*models.Comment) map[string]*models.Comment {
+	latest := make(map[string]*models.Comment, len(comments))
+	for _, comment := range comments {
+		latest[comment.PostID] = comment
+	}
+	return latest
+}
+
+func scanComments(rows *sql.Rows) ([]*models.Comment, error) {
+	var comments []*models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteStorage keeps posts and comments in a local database file. It shares
+// its queries with PostgresStorage, see sqlStorage; the database is opened
+// with a single connection, so writes never race each other and no row locks
+// are needed.
+type SQLiteStorage struct {
+	sqlStorage
+}
+
+func NewStorageSQLite(db *sql.DB) *SQLiteStorage {
+	return &SQLiteStorage{newSQLStorage(db, sqliteDialect)}
+}
+
+var sqliteDialect = sqlDialect{
+	system: semconv.DBSystemSqlite,
+	// A reply is only inserted when its parent is in the same post and not
+	// nested too deeply.
+	addComment: `
+        INSERT INTO comments (id, post_id, parent_id, author_id, text, created_at, depth)
+        SELECT $1, $2, $3, $4, $5, $6,
+            COALESCE((SELECT depth + 1 FROM comments WHERE id = $3 AND post_id = $2), 1)
+        FROM posts
+        WHERE id = $2 AND allow_comments
+            AND ($3 IS NULL OR EXISTS (
+                SELECT 1 FROM comments WHERE id = $3 AND post_id = $2 AND depth < $7
+            ))
+        RETURNING ` + commentColumns + `
+    `,
+	lockComment: "SELECT id FROM comments WHERE id = $1",
+	// SQLite has no DISTINCT ON, so the newest comment of each post is picked
+	// with a window function. The IDs are passed as one JSON array.
+	latestComments: `
+        SELECT ` + commentColumns + `
+        FROM (
+            SELECT ` + commentColumns + `,
+                ROW_NUMBER() OVER (PARTITION BY post_id ORDER BY created_at DESC, id DESC) AS position
+            FROM comments
+            WHERE post_id IN (SELECT value FROM json_each($1)) AND parent_id IS NULL
+        )
+        WHERE position = 1
+    `,
+	idList: func(ids []string) interface{} {
+		list, _ := json.Marshal(ids)
+		return string(list)
+	},
+	insertError: sqliteConflictError,
+}
+
+// sqliteConflictError is conflictError for the errors of the SQLite driver.
+func sqliteConflictError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY, sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+			return newError(ErrConflict, "a row with the same key already exists")
+		}
+	}
+	return err
+}
+
+// HealthCheck checks that the database file is readable and migrated.
+func (s *SQLiteStorage) HealthCheck(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return checkSchemaVersion(ctx, s.db.DB, filepath.Join(getMigrationDir(), "sqlite"))
+}
+
+func (s *SQLiteStorage) ApplyMigrations(migrationDir string) error {
+	migrationDir = filepath.ToSlash(strings.ReplaceAll(migrationDir, ":", "|"))
+	if !strings.HasPrefix(migrationDir, "file://") {
+		migrationDir = "file://" + migrationDir
+	}
+
+	dbDriver, err := migratesqlite.WithInstance(s.db.DB, &migratesqlite.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to initialize SQLite driver: %w", err)
+	}
+
+	m, err := migrate.NewWithDatabaseInstance(
+		migrationDir,
+		"sqlite",
+		dbDriver,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	slog.Info("Migrations applied successfully")
+	return nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"ozontz/app/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLitePersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := InitSQLiteDB(path)
+	require.NoError(t, err)
+	store := NewStorageSQLite(db)
+
+	post, err := store.CreatePost(ctx, &models.Post{Title: "Title", Content: "Content", AuthorID: "user-1", AllowComments: true})
+	require.NoError(t, err)
+	comment, err := store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Comment"})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// Migrations that were already applied must be skipped on the second open.
+	db, err = InitSQLiteDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+	store = NewStorageSQLite(db)
+
+	reopened, err := store.GetPostByID(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, post.Title, reopened.Title)
+	assert.True(t, post.CreatedAt.Equal(reopened.CreatedAt), "creation time should survive a round trip")
+
+	latest, err := store.GetLatestComment(ctx, post.ID)
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, comment.ID, latest.ID)
+}
+
+func TestSQLiteCancelledContext(t *testing.T) {
+	db, err := InitSQLiteDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	store := NewStorageSQLite(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = store.GetPosts(ctx, PageArgs{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSQLiteHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	db, err := InitSQLiteDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	store := NewStorageSQLite(db)
+
+	require.NoError(t, store.HealthCheck(ctx))
+
+	_, err = db.Exec("UPDATE schema_migrations SET dirty = 1")
+	require.NoError(t, err)
+	assert.ErrorContains(t, store.HealthCheck(ctx), "did not complete")
+
+	_, err = db.Exec("UPDATE schema_migrations SET version = 1, dirty = 0")
+	require.NoError(t, err)
+	assert.ErrorContains(t, store.HealthCheck(ctx), "schema version 1 is behind migration 2")
+
+	require.NoError(t, db.Close())
+	assert.ErrorContains(t, store.HealthCheck(ctx), "failed to ping database")
+}
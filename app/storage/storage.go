@@ -3,27 +3,105 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"net"
+	"net/url"
 	"ozontz/app/models"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	textLen       = 2000
-	commentsCount = 5
-	postsCount    = 10
+	threadDepth    = 3
+	maxThreadDepth = 10
+	deletedText    = "[deleted]"
+
+	// Replies nested deeper than commentThread can return are rejected.
+	maxCommentDepth = maxThreadDepth
 )
 
+// Limits bound what a Storage returns and accepts.
+type Limits struct {
+	// PostsPageSize and CommentsPageSize are the page sizes used when a
+	// request asks for neither first nor last.
+	PostsPageSize    int `yaml:"posts_page_size"`
+	CommentsPageSize int `yaml:"comments_page_size"`
+	// MaxTextLength is the longest comment text accepted, in characters.
+	MaxTextLength int `yaml:"max_text_length"`
+}
+
+var DefaultLimits = Limits{
+	PostsPageSize:    10,
+	CommentsPageSize: 5,
+	MaxTextLength:    2000,
+}
+
+var limits = DefaultLimits
+
+// SetLimits replaces the limits of every Storage. It must be called before
+// the stores are used.
+func SetLimits(l Limits) {
+	limits = l
+}
+
+// CurrentLimits returns the limits set with SetLimits.
+func CurrentLimits() Limits {
+	return limits
+}
+
+func (l Limits) Validate() error {
+	var errs []error
+	if l.PostsPageSize < 1 || l.PostsPageSize > MaxPageSize {
+		errs = append(errs, fmt.Errorf("posts page size must be between 1 and %d", MaxPageSize))
+	}
+	if l.CommentsPageSize < 1 || l.CommentsPageSize > MaxPageSize {
+		errs = append(errs, fmt.Errorf("comments page size must be between 1 and %d", MaxPageSize))
+	}
+	if l.MaxTextLength < 1 {
+		errs = append(errs, errors.New("max text length must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
 type Storage interface {
-	GetPosts(ctx context.Context) ([]*models.Post, error)
+	GetPosts(ctx context.Context, page PageArgs) (*Page[*models.Post], error)
 	GetPostByID(ctx context.Context, id string) (*models.Post, error)
 	CreatePost(ctx context.Context, post *models.Post) (*models.Post, error)
+	UpdatePost(ctx context.Context, id string, title, content *string) (*models.Post, error)
+	DeletePost(ctx context.Context, id string) error
+	SetCommentsAllowed(ctx context.Context, postId string, allowed bool) (*models.Post, error)
 	AddComment(ctx context.Context, comment *models.Comment) (*models.Comment, error)
-	GetComments(ctx context.Context, postId string, after *string) ([]*models.Comment, error)
+	GetCommentByID(ctx context.Context, id string) (*models.Comment, error)
+	UpdateComment(ctx context.Context, id string, text string) (*models.Comment, error)
+	DeleteComment(ctx context.Context, id string) error
+	GetComments(ctx context.Context, postId string, page PageArgs) (*Page[*models.Comment], error)
 	GetLatestComment(ctx context.Context, postId string) (*models.Comment, error)
+	// GetLatestComments is GetLatestComment for several posts at once. Posts
+	// without top-level comments are missing from the result.
+	GetLatestComments(ctx context.Context, postIds []string) (map[string]*models.Comment, error)
+	GetReplies(ctx context.Context, parentId string, page PageArgs) (*Page[*models.Comment], error)
+	GetCommentThread(ctx context.Context, postId string, depth int) ([]*models.Comment, error)
+	// HealthCheck reports why the storage can't serve requests, or nil when
+	// it can.
+	HealthCheck(ctx context.Context) error
+}
+
+// NormalizeDepth returns the depth GetCommentThread reads for the requested
+// one: the default for zero or less, at most the deepest thread allowed.
+func NormalizeDepth(depth int) int {
+	if depth <= 0 {
+		return threadDepth
+	}
+	if depth > maxThreadDepth {
+		return maxThreadDepth
+	}
+	return depth
 }
 
 func getMigrationDir() string {
@@ -34,47 +112,161 @@ func getMigrationDir() string {
 	return migrationDir
 }
 
-func InitPostgresDB() (*sql.DB, error) {
-	dbUser := os.Getenv("DB_USER")
-	if dbUser == "" {
-		return nil, fmt.Errorf("environment variable DB_USER is not set")
+// latestMigration returns the version of the newest migration in dir.
+func latestMigration(dir string) (uint64, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return 0, err
 	}
-	dbPassword := os.Getenv("DB_PASSWORD")
-	if dbPassword == "" {
-		return nil, fmt.Errorf("environment variable DB_PASSWORD is not set")
+
+	var latest uint64
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(filepath.Base(file), "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration file name %s", filepath.Base(file))
+		}
+		latest = max(latest, version)
 	}
-	dbHost := os.Getenv("DB_HOST")
-	if dbHost == "" {
-		return nil, fmt.Errorf("environment variable DB_HOST is not set")
+	return latest, nil
+}
+
+// checkSchemaVersion fails unless every migration of dir is applied and the
+// last one did not stop half way.
+func checkSchemaVersion(ctx context.Context, db *sql.DB, dir string) error {
+	latest, err := latestMigration(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
 	}
-	dbPort := os.Getenv("DB_PORT")
-	if dbPort == "" {
-		return nil, fmt.Errorf("environment variable DB_PORT is not set")
+
+	var version uint64
+	var dirty bool
+	if err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations").Scan(&version, &dirty); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("migration %d did not complete", version)
 	}
-	dbName := os.Getenv("DB_NAME")
-	if dbName == "" {
-		return nil, fmt.Errorf("environment variable DB_NAME is not set")
+	if version < latest {
+		return fmt.Errorf("schema version %d is behind migration %d", version, latest)
 	}
+	return nil
+}
+
+// PostgresConfig locates the database and sizes the connection pool. DSN,
+// when set, is used as is instead of the discrete connection parameters.
+type PostgresConfig struct {
+	DSN      string `yaml:"dsn"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
 
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		dbUser, dbPassword, dbHost, dbPort, dbName)
+	// MaxOpenConns of zero leaves the pool unbounded.
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+var DefaultPostgresConfig = PostgresConfig{
+	Port:         5432,
+	SSLMode:      "disable",
+	MaxIdleConns: 2,
+}
+
+// sslModes are the sslmode values lib/pq understands.
+var sslModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// ConnString returns the connection string for lib/pq.
+func (c PostgresConfig) ConnString() (string, error) {
+	if c.DSN != "" {
+		return c.DSN, nil
+	}
+
+	var missing []string
+	if c.Host == "" {
+		missing = append(missing, "host")
+	}
+	if c.User == "" {
+		missing = append(missing, "user")
+	}
+	if c.Name == "" {
+		missing = append(missing, "name")
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("database %s not set, configure them or a DSN", strings.Join(missing, ", "))
+	}
+	if !slices.Contains(sslModes, c.SSLMode) {
+		return "", fmt.Errorf("unknown sslmode %q, expected one of %s", c.SSLMode, strings.Join(sslModes, ", "))
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		Path:     "/" + c.Name,
+		RawQuery: url.Values{"sslmode": {c.SSLMode}}.Encode(),
+	}
+	return dsn.String(), nil
+}
+
+func InitPostgresDB(cfg PostgresConfig) (*sql.DB, error) {
+	dsn, err := cfg.ConnString()
+	if err != nil {
+		return nil, err
+	}
 
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
-	log.Println("Database connection established")
+	slog.Info("Database connection established")
 
 	migrationDir := getMigrationDir()
 	store := NewStoragePostgres(db)
 	if err := store.ApplyMigrations(migrationDir); err != nil {
 		return nil, fmt.Errorf("failed to apply migrations: %w", err)
 	}
-	log.Println("Migrations applied successfully")
+	slog.Info("Migrations applied successfully")
+
+	return db, nil
+}
+
+// SQLiteDSN opens path with foreign keys enforced. Times are written in a
+// single UTC layout so that comparing them as text orders them correctly,
+// which the keyset pagination relies on.
+func SQLiteDSN(path string) string {
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+}
+
+func InitSQLiteDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", SQLiteDSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows a single writer, so one connection serializes writes
+	// instead of failing them with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	slog.Info("Database opened")
+
+	migrationDir := filepath.Join(getMigrationDir(), "sqlite")
+	store := NewStorageSQLite(db)
+	if err := store.ApplyMigrations(migrationDir); err != nil {
+		return nil, fmt.Errorf("failed to apply migrations: %w", err)
+	}
 
 	return db, nil
 }
@@ -0,0 +1,688 @@
+// Package storagetest is a conformance suite for storage.Storage
+// implementations. Every backend runs the same contract so they stay
+// interchangeable.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"ozontz/app/models"
+	"ozontz/app/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Limits every backend applies, as documented in the README.
+const (
+	defaultPostsPage    = 10
+	defaultCommentsPage = 5
+	maxPageSize         = 100
+	maxTextLength       = 2000
+	defaultThreadDepth  = 3
+	maxThreadDepth      = 10
+	maxCommentDepth     = 10
+	deletedText         = "[deleted]"
+)
+
+// Run exercises the Storage contract. newStore is called once per subtest and
+// must return an empty store.
+func Run(t *testing.T, newStore func() storage.Storage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store storage.Storage)
+	}{
+		{"Posts", testPosts},
+		{"PostsPagination", testPostsPagination},
+		{"PageSizeLimit", testPageSizeLimit},
+		{"Comments", testComments},
+		{"Replies", testReplies},
+		{"LatestComment", testLatestComment},
+		{"LatestComments", testLatestComments},
+		{"CommentThread", testCommentThread},
+		{"UpdateAndDeleteComment", testUpdateAndDeleteComment},
+		{"DeletePostRemovesComments", testDeletePostRemovesComments},
+		{"CommentsDisabled", testCommentsDisabled},
+		{"Errors", testErrors},
+		{"ConcurrentComments", testConcurrentComments},
+		{"HealthCheck", testHealthCheck},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore())
+		})
+	}
+}
+
+func createPost(t *testing.T, store storage.Storage, title string, allowComments bool) *models.Post {
+	t.Helper()
+	post, err := store.CreatePost(context.Background(), &models.Post{
+		Title:         title,
+		Content:       "Content of " + title,
+		AuthorID:      "user-1",
+		AllowComments: allowComments,
+	})
+	require.NoError(t, err)
+	return post
+}
+
+func addComment(t *testing.T, store storage.Storage, postId string, parentId *string, text string) *models.Comment {
+	t.Helper()
+	comment, err := store.AddComment(context.Background(), &models.Comment{
+		PostID:   postId,
+		ParentID: parentId,
+		AuthorID: "user-2",
+		Text:     text,
+	})
+	require.NoError(t, err)
+	return comment
+}
+
+func postKey(post *models.Post) storage.Cursor {
+	return storage.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}
+}
+
+func commentKey(comment *models.Comment) storage.Cursor {
+	return storage.Cursor{CreatedAt: comment.CreatedAt, ID: comment.ID}
+}
+
+func less(a, b storage.Cursor) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+func ids[T any](items []T, id func(T) string) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, id(item))
+	}
+	return out
+}
+
+func postIDs(posts []*models.Post) []string {
+	return ids(posts, func(p *models.Post) string { return p.ID })
+}
+
+func commentIDs(comments []*models.Comment) []string {
+	return ids(comments, func(c *models.Comment) string { return c.ID })
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func stringPtr(v string) *string {
+	return &v
+}
+
+func testPosts(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+	assert.NotEmpty(t, post.ID)
+	assert.False(t, post.CreatedAt.IsZero())
+	assert.Nil(t, post.UpdatedAt)
+
+	got, err := store.GetPostByID(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, post.ID, got.ID)
+	assert.Equal(t, "Post", got.Title)
+	assert.Equal(t, "Content of Post", got.Content)
+	assert.Equal(t, "user-1", got.AuthorID)
+	assert.True(t, got.AllowComments)
+	assert.True(t, post.CreatedAt.Equal(got.CreatedAt))
+
+	updated, err := store.UpdatePost(ctx, post.ID, stringPtr("New title"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "New title", updated.Title)
+	assert.Equal(t, "Content of Post", updated.Content, "Omitted fields must be kept")
+	assert.NotNil(t, updated.UpdatedAt)
+
+	locked, err := store.SetCommentsAllowed(ctx, post.ID, false)
+	require.NoError(t, err)
+	assert.False(t, locked.AllowComments)
+
+	require.NoError(t, store.DeletePost(ctx, post.ID))
+	_, err = store.GetPostByID(ctx, post.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testPostsPagination(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	const total = 23
+	for i := 0; i < total; i++ {
+		createPost(t, store, fmt.Sprintf("Post %d", i), true)
+	}
+
+	all, err := store.GetPosts(ctx, storage.PageArgs{First: intPtr(maxPageSize)})
+	require.NoError(t, err)
+	require.Len(t, all.Items, total)
+	assert.Equal(t, total, all.TotalCount)
+	assert.False(t, all.HasNextPage)
+	assert.False(t, all.HasPreviousPage)
+	for i := 1; i < len(all.Items); i++ {
+		assert.True(t, less(postKey(all.Items[i]), postKey(all.Items[i-1])), "Posts must be ordered newest first")
+	}
+
+	first, err := store.GetPosts(ctx, storage.PageArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, postIDs(all.Items[:defaultPostsPage]), postIDs(first.Items), "Default page size")
+	assert.True(t, first.HasNextPage)
+	assert.False(t, first.HasPreviousPage)
+
+	empty, err := store.GetPosts(ctx, storage.PageArgs{First: intPtr(0)})
+	require.NoError(t, err)
+	assert.Empty(t, empty.Items)
+
+	// Walk forward with cursors built from the returned items.
+	var forward []*models.Post
+	args := storage.PageArgs{First: intPtr(7)}
+	for {
+		page, err := store.GetPosts(ctx, args)
+		require.NoError(t, err)
+		assert.Equal(t, args.After != nil, page.HasPreviousPage)
+		assert.Equal(t, total, page.TotalCount)
+		forward = append(forward, page.Items...)
+		if !page.HasNextPage {
+			break
+		}
+		last := page.Items[len(page.Items)-1]
+		args.After = stringPtr(storage.EncodeCursor(last.CreatedAt, last.ID))
+	}
+	assert.Equal(t, postIDs(all.Items), postIDs(forward))
+
+	// And backward from the end.
+	var backward []*models.Post
+	args = storage.PageArgs{Last: intPtr(7)}
+	for {
+		page, err := store.GetPosts(ctx, args)
+		require.NoError(t, err)
+		assert.Equal(t, args.Before != nil, page.HasNextPage)
+		backward = append(page.Items, backward...)
+		if !page.HasPreviousPage {
+			break
+		}
+		first := page.Items[0]
+		args.Before = stringPtr(storage.EncodeCursor(first.CreatedAt, first.ID))
+	}
+	assert.Equal(t, postIDs(all.Items), postIDs(backward))
+
+	// Both bounds select the items strictly between them.
+	window, err := store.GetPosts(ctx, storage.PageArgs{
+		First:  intPtr(maxPageSize),
+		After:  stringPtr(storage.EncodeCursor(all.Items[2].CreatedAt, all.Items[2].ID)),
+		Before: stringPtr(storage.EncodeCursor(all.Items[6].CreatedAt, all.Items[6].ID)),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, postIDs(all.Items[3:6]), postIDs(window.Items))
+}
+
+func testPageSizeLimit(t *testing.T, store storage.Storage) {
+	post := createPost(t, store, "Post", true)
+	for i := 0; i < maxPageSize+1; i++ {
+		addComment(t, store, post.ID, nil, fmt.Sprintf("Comment %d", i))
+	}
+
+	page, err := store.GetComments(context.Background(), post.ID, storage.PageArgs{First: intPtr(maxPageSize * 10)})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, maxPageSize)
+	assert.True(t, page.HasNextPage)
+	assert.Equal(t, maxPageSize+1, page.TotalCount)
+}
+
+func testComments(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+	other := createPost(t, store, "Other", true)
+	addComment(t, store, other.ID, nil, "Elsewhere")
+
+	const total = 12
+	var parent *models.Comment
+	for i := 0; i < total; i++ {
+		var parentId *string
+		if i%3 == 2 {
+			parentId = &parent.ID
+		}
+		comment := addComment(t, store, post.ID, parentId, fmt.Sprintf("Comment %d", i))
+		assert.NotEmpty(t, comment.ID)
+		assert.Equal(t, post.ID, comment.PostID)
+		assert.False(t, comment.CreatedAt.IsZero())
+		if parentId == nil {
+			parent = comment
+		}
+	}
+
+	all, err := store.GetComments(ctx, post.ID, storage.PageArgs{First: intPtr(maxPageSize)})
+	require.NoError(t, err)
+	require.Len(t, all.Items, total, "Comments include replies and only this post's comments")
+	assert.Equal(t, total, all.TotalCount)
+	for i := 1; i < len(all.Items); i++ {
+		assert.True(t, less(commentKey(all.Items[i-1]), commentKey(all.Items[i])), "Comments must be ordered oldest first")
+	}
+
+	first, err := store.GetComments(ctx, post.ID, storage.PageArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, commentIDs(all.Items[:defaultCommentsPage]), commentIDs(first.Items), "Default page size")
+	assert.True(t, first.HasNextPage)
+
+	var forward []*models.Comment
+	args := storage.PageArgs{First: intPtr(5)}
+	for {
+		page, err := store.GetComments(ctx, post.ID, args)
+		require.NoError(t, err)
+		forward = append(forward, page.Items...)
+		if !page.HasNextPage {
+			break
+		}
+		last := page.Items[len(page.Items)-1]
+		args.After = stringPtr(storage.EncodeCursor(last.CreatedAt, last.ID))
+	}
+	assert.Equal(t, commentIDs(all.Items), commentIDs(forward))
+
+	tail, err := store.GetComments(ctx, post.ID, storage.PageArgs{Last: intPtr(4)})
+	require.NoError(t, err)
+	assert.Equal(t, commentIDs(all.Items[total-4:]), commentIDs(tail.Items))
+	assert.True(t, tail.HasPreviousPage)
+	assert.False(t, tail.HasNextPage)
+
+	none, err := store.GetComments(ctx, "missing", storage.PageArgs{})
+	require.NoError(t, err)
+	assert.Empty(t, none.Items)
+	assert.Zero(t, none.TotalCount)
+
+	got, err := store.GetCommentByID(ctx, all.Items[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, all.Items[0].Text, got.Text)
+	assert.True(t, all.Items[0].CreatedAt.Equal(got.CreatedAt))
+}
+
+func testReplies(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+	root := addComment(t, store, post.ID, nil, "Root")
+	sibling := addComment(t, store, post.ID, nil, "Sibling")
+	addComment(t, store, post.ID, &sibling.ID, "Sibling reply")
+
+	var replies []*models.Comment
+	for i := 0; i < 7; i++ {
+		reply := addComment(t, store, post.ID, &root.ID, fmt.Sprintf("Reply %d", i))
+		require.NotNil(t, reply.ParentID)
+		assert.Equal(t, root.ID, *reply.ParentID)
+		replies = append(replies, reply)
+	}
+	addComment(t, store, post.ID, &replies[0].ID, "Nested reply")
+
+	page, err := store.GetReplies(ctx, root.ID, storage.PageArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, commentIDs(replies[:defaultCommentsPage]), commentIDs(page.Items), "Only direct replies, oldest first")
+	assert.Equal(t, len(replies), page.TotalCount)
+	assert.True(t, page.HasNextPage)
+
+	last := page.Items[len(page.Items)-1]
+	rest, err := store.GetReplies(ctx, root.ID, storage.PageArgs{After: stringPtr(storage.EncodeCursor(last.CreatedAt, last.ID))})
+	require.NoError(t, err)
+	assert.Equal(t, commentIDs(replies[defaultCommentsPage:]), commentIDs(rest.Items))
+	assert.False(t, rest.HasNextPage)
+	assert.True(t, rest.HasPreviousPage)
+}
+
+func testLatestComment(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+
+	latest, err := store.GetLatestComment(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Nil(t, latest, "A post without comments has no latest comment")
+
+	addComment(t, store, post.ID, nil, "First")
+	second := addComment(t, store, post.ID, nil, "Second")
+	addComment(t, store, post.ID, &second.ID, "Reply")
+
+	latest, err = store.GetLatestComment(ctx, post.ID)
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, second.ID, latest.ID, "Replies are not considered")
+}
+
+func testLatestComments(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	first := createPost(t, store, "First", true)
+	second := createPost(t, store, "Second", true)
+	empty := createPost(t, store, "Empty", true)
+
+	addComment(t, store, first.ID, nil, "Older")
+	firstLatest := addComment(t, store, first.ID, nil, "Newer")
+	addComment(t, store, first.ID, &firstLatest.ID, "Reply")
+	secondLatest := addComment(t, store, second.ID, nil, "Only")
+
+	latest, err := store.GetLatestComments(ctx, []string{first.ID, second.ID, empty.ID, "post-unknown"})
+	require.NoError(t, err)
+	require.Len(t, latest, 2, "Posts without comments are left out")
+	assert.Equal(t, firstLatest.ID, latest[first.ID].ID)
+	assert.Equal(t, secondLatest.ID, latest[second.ID].ID)
+
+	latest, err = store.GetLatestComments(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, latest)
+}
+
+func testCommentThread(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+	other := createPost(t, store, "Other", true)
+	addComment(t, store, other.ID, nil, "Elsewhere")
+
+	// Two chains deeper than the maximum thread depth.
+	var all []*models.Comment
+	for chain := 0; chain < 2; chain++ {
+		var parentId *string
+		for depth := 1; depth <= maxCommentDepth; depth++ {
+			comment := addComment(t, store, post.ID, parentId, fmt.Sprintf("Chain %d depth %d", chain, depth))
+			all = append(all, comment)
+			parentId = &comment.ID
+		}
+	}
+
+	depthOf := func(comments []*models.Comment) map[string]int {
+		depths := make(map[string]int, len(comments))
+		for _, comment := range comments {
+			depths[comment.ID] = 1
+			if comment.ParentID != nil {
+				depths[comment.ID] = depths[*comment.ParentID] + 1
+			}
+		}
+		return depths
+	}
+	depths := depthOf(all)
+	upTo := func(max int) []string {
+		var out []string
+		for _, comment := range all {
+			if depths[comment.ID] <= max {
+				out = append(out, comment.ID)
+			}
+		}
+		return out
+	}
+
+	for _, tt := range []struct {
+		depth, levels int
+	}{
+		{0, defaultThreadDepth},
+		{2, 2},
+		{maxThreadDepth + 5, maxThreadDepth},
+	} {
+		thread, err := store.GetCommentThread(ctx, post.ID, tt.depth)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, upTo(tt.levels), commentIDs(thread), "depth %d", tt.depth)
+		for i := 1; i < len(thread); i++ {
+			assert.True(t, less(commentKey(thread[i-1]), commentKey(thread[i])), "Thread must be ordered oldest first")
+		}
+	}
+
+	empty := createPost(t, store, "Empty", true)
+	thread, err := store.GetCommentThread(ctx, empty.ID, 0)
+	require.NoError(t, err)
+	assert.Empty(t, thread)
+}
+
+func testUpdateAndDeleteComment(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+	parent := addComment(t, store, post.ID, nil, "Parent")
+	reply := addComment(t, store, post.ID, &parent.ID, "Reply")
+	leaf := addComment(t, store, post.ID, nil, "Leaf")
+
+	updated, err := store.UpdateComment(ctx, leaf.ID, "Edited")
+	require.NoError(t, err)
+	assert.Equal(t, "Edited", updated.Text)
+	assert.NotNil(t, updated.UpdatedAt)
+
+	// A comment without replies is removed.
+	require.NoError(t, store.DeleteComment(ctx, leaf.ID))
+	_, err = store.GetCommentByID(ctx, leaf.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// A comment with replies becomes a tombstone so the thread stays intact.
+	require.NoError(t, store.DeleteComment(ctx, parent.ID))
+	tombstone, err := store.GetCommentByID(ctx, parent.ID)
+	require.NoError(t, err)
+	assert.True(t, tombstone.Deleted)
+	assert.Equal(t, deletedText, tombstone.Text)
+
+	replies, err := store.GetReplies(ctx, parent.ID, storage.PageArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{reply.ID}, commentIDs(replies.Items))
+}
+
+func testDeletePostRemovesComments(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+	other := createPost(t, store, "Other", true)
+	root := addComment(t, store, post.ID, nil, "Root")
+	reply := addComment(t, store, post.ID, &root.ID, "Reply")
+	kept := addComment(t, store, other.ID, nil, "Kept")
+
+	require.NoError(t, store.DeletePost(ctx, post.ID))
+
+	for _, id := range []string{root.ID, reply.ID} {
+		_, err := store.GetCommentByID(ctx, id)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+	_, err := store.GetCommentByID(ctx, kept.ID)
+	assert.NoError(t, err)
+}
+
+func testCommentsDisabled(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+	addComment(t, store, post.ID, nil, "Before")
+
+	_, err := store.SetCommentsAllowed(ctx, post.ID, false)
+	require.NoError(t, err)
+
+	_, err = store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "After"})
+	assert.ErrorIs(t, err, storage.ErrCommentsDisabled)
+
+	page, err := store.GetComments(ctx, post.ID, storage.PageArgs{})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 1, "Existing comments stay readable")
+
+	_, err = store.SetCommentsAllowed(ctx, post.ID, true)
+	require.NoError(t, err)
+	addComment(t, store, post.ID, nil, "Reopened")
+}
+
+// testErrors checks that every failure path returns the documented sentinel,
+// so callers can classify errors the same way for every backend.
+func testErrors(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+	locked := createPost(t, store, "Locked", false)
+	comment := addComment(t, store, post.ID, nil, "Comment")
+	addComment(t, store, post.ID, &comment.ID, "Reply")
+
+	missing := "missing"
+	longText := strings.Repeat("a", maxTextLength+1)
+	badCursor := "not a cursor"
+
+	assertIs := func(t *testing.T, err error, targets ...error) {
+		t.Helper()
+		for _, target := range targets {
+			assert.ErrorIs(t, err, target)
+		}
+	}
+
+	t.Run("Post not found", func(t *testing.T) {
+		_, err := store.GetPostByID(ctx, missing)
+		assertIs(t, err, storage.ErrPostNotFound, storage.ErrNotFound)
+
+		_, err = store.UpdatePost(ctx, missing, &missing, nil)
+		assertIs(t, err, storage.ErrPostNotFound, storage.ErrNotFound)
+
+		_, err = store.SetCommentsAllowed(ctx, missing, false)
+		assertIs(t, err, storage.ErrPostNotFound, storage.ErrNotFound)
+
+		err = store.DeletePost(ctx, missing)
+		assertIs(t, err, storage.ErrPostNotFound, storage.ErrNotFound)
+
+		_, err = store.AddComment(ctx, &models.Comment{PostID: missing, AuthorID: "user-2", Text: "Comment"})
+		assertIs(t, err, storage.ErrPostNotFound, storage.ErrNotFound)
+
+		_, err = store.GetCommentThread(ctx, missing, 0)
+		assertIs(t, err, storage.ErrPostNotFound, storage.ErrNotFound)
+	})
+
+	t.Run("Comment not found", func(t *testing.T) {
+		_, err := store.GetCommentByID(ctx, missing)
+		assertIs(t, err, storage.ErrCommentNotFound, storage.ErrNotFound)
+
+		_, err = store.UpdateComment(ctx, missing, "Text")
+		assertIs(t, err, storage.ErrCommentNotFound, storage.ErrNotFound)
+
+		err = store.DeleteComment(ctx, missing)
+		assertIs(t, err, storage.ErrCommentNotFound, storage.ErrNotFound)
+	})
+
+	t.Run("Parent not found", func(t *testing.T) {
+		_, err := store.AddComment(ctx, &models.Comment{PostID: post.ID, ParentID: &missing, AuthorID: "user-2", Text: "Reply"})
+		assertIs(t, err, storage.ErrParentNotFound, storage.ErrNotFound)
+	})
+
+	t.Run("Parent in another post", func(t *testing.T) {
+		other := createPost(t, store, "Other", true)
+
+		_, err := store.AddComment(ctx, &models.Comment{PostID: other.ID, ParentID: &comment.ID, AuthorID: "user-2", Text: "Reply"})
+		assertIs(t, err, storage.ErrParentMismatch, storage.ErrInvalidInput)
+	})
+
+	t.Run("Thread too deep", func(t *testing.T) {
+		parent := comment
+		for depth := 2; depth <= maxCommentDepth; depth++ {
+			parent = addComment(t, store, post.ID, &parent.ID, fmt.Sprintf("Depth %d", depth))
+		}
+
+		_, err := store.AddComment(ctx, &models.Comment{PostID: post.ID, ParentID: &parent.ID, AuthorID: "user-2", Text: "Reply"})
+		assertIs(t, err, storage.ErrThreadTooDeep, storage.ErrInvalidInput)
+	})
+
+	t.Run("Comments disabled", func(t *testing.T) {
+		_, err := store.AddComment(ctx, &models.Comment{PostID: locked.ID, AuthorID: "user-2", Text: "Comment"})
+		assertIs(t, err, storage.ErrCommentsDisabled)
+	})
+
+	t.Run("Text too long", func(t *testing.T) {
+		_, err := store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: longText})
+		assertIs(t, err, storage.ErrTextTooLong, storage.ErrInvalidInput)
+
+		_, err = store.UpdateComment(ctx, comment.ID, longText)
+		assertIs(t, err, storage.ErrTextTooLong, storage.ErrInvalidInput)
+
+		addComment(t, store, post.ID, nil, strings.Repeat("a", maxTextLength))
+		addComment(t, store, post.ID, nil, strings.Repeat("я", maxTextLength))
+	})
+
+	t.Run("Invalid cursor", func(t *testing.T) {
+		_, err := store.GetPosts(ctx, storage.PageArgs{After: &badCursor})
+		assertIs(t, err, storage.ErrInvalidCursor, storage.ErrInvalidInput)
+
+		_, err = store.GetComments(ctx, post.ID, storage.PageArgs{Before: &badCursor})
+		assertIs(t, err, storage.ErrInvalidCursor, storage.ErrInvalidInput)
+
+		_, err = store.GetReplies(ctx, comment.ID, storage.PageArgs{After: &badCursor})
+		assertIs(t, err, storage.ErrInvalidCursor, storage.ErrInvalidInput)
+	})
+
+	t.Run("Invalid page arguments", func(t *testing.T) {
+		_, err := store.GetPosts(ctx, storage.PageArgs{First: intPtr(1), Last: intPtr(1)})
+		assertIs(t, err, storage.ErrInvalidInput)
+
+		_, err = store.GetComments(ctx, post.ID, storage.PageArgs{First: intPtr(-1)})
+		assertIs(t, err, storage.ErrInvalidInput)
+	})
+
+	t.Run("Deleted comment", func(t *testing.T) {
+		// The comment has a reply, so deleting it leaves a tombstone.
+		require.NoError(t, store.DeleteComment(ctx, comment.ID))
+
+		_, err := store.UpdateComment(ctx, comment.ID, "Edited")
+		assertIs(t, err, storage.ErrCommentDeleted, storage.ErrConflict)
+	})
+}
+
+func testConcurrentComments(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, store, "Post", true)
+	root := addComment(t, store, post.ID, nil, "Root")
+
+	const writers, perWriter = 8, 10
+
+	var wg sync.WaitGroup
+	created := make(chan string, writers*perWriter)
+	errs := make(chan error, writers*perWriter+writers)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				comment, err := store.AddComment(ctx, &models.Comment{
+					PostID:   post.ID,
+					ParentID: &root.ID,
+					AuthorID: fmt.Sprintf("user-%d", w),
+					Text:     fmt.Sprintf("Reply %d-%d", w, i),
+				})
+				if err != nil {
+					errs <- err
+					continue
+				}
+				created <- comment.ID
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			if _, err := store.GetReplies(ctx, root.ID, storage.PageArgs{First: intPtr(maxPageSize)}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(created)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Concurrent call failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for id := range created {
+		assert.False(t, seen[id], "Duplicate comment ID %s", id)
+		seen[id] = true
+	}
+
+	replies, err := store.GetReplies(ctx, root.ID, storage.PageArgs{First: intPtr(maxPageSize)})
+	require.NoError(t, err)
+	assert.Equal(t, writers*perWriter, replies.TotalCount)
+	assert.Len(t, replies.Items, writers*perWriter)
+}
+
+func testHealthCheck(t *testing.T, store storage.Storage) {
+	assert.NoError(t, store.HealthCheck(context.Background()))
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("ozontz/app/storage")
+
+// tracedDB starts a span for every statement the SQL storages run.
+type tracedDB struct {
+	*sql.DB
+	// system is the db.system attribute of every span, such as
+	// semconv.DBSystemPostgreSQL.
+	system attribute.KeyValue
+}
+
+func (db tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startStatement(ctx, db.system, query)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	endStatement(span, err)
+	return rows, err
+}
+
+func (db tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startStatement(ctx, db.system, query)
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	endStatement(span, row.Err())
+	return row
+}
+
+func (db tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startStatement(ctx, db.system, query)
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	endStatement(span, err)
+	return result, err
+}
+
+func (db tracedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (tracedTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	return tracedTx{tx, db.system}, err
+}
+
+// tracedTx is the transaction counterpart of tracedDB.
+type tracedTx struct {
+	*sql.Tx
+	system attribute.KeyValue
+}
+
+func (tx tracedTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startStatement(ctx, tx.system, query)
+	row := tx.Tx.QueryRowContext(ctx, query, args...)
+	endStatement(span, row.Err())
+	return row
+}
+
+func (tx tracedTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startStatement(ctx, tx.system, query)
+	result, err := tx.Tx.ExecContext(ctx, query, args...)
+	endStatement(span, err)
+	return result, err
+}
+
+// startStatement names the span after the SQL keyword the statement starts
+// with, such as SELECT or WITH. Arguments are never recorded.
+func startStatement(ctx context.Context, system attribute.KeyValue, query string) (context.Context, trace.Span) {
+	statement := strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(statement, " ")
+	operation = strings.ToUpper(operation)
+
+	return tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			system,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(statement),
+		),
+	)
+}
+
+func endStatement(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestTracedDB(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	t.Cleanup(func() { tracer = previous })
+
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := NewStorageSQLite(sqlDB).db
+	ctx := context.Background()
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE posts (id TEXT PRIMARY KEY)")
+	require.NoError(t, err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	_, err = tx.ExecContext(ctx, "INSERT INTO posts (id) VALUES (?)", "post-1")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	var id string
+	require.NoError(t, db.QueryRowContext(ctx, `
+        SELECT id
+        FROM posts
+        WHERE id = ?
+    `, "post-1").Scan(&id))
+	assert.Equal(t, "post-1", id)
+
+	_, err = db.QueryContext(ctx, "SELECT missing FROM posts")
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	assert.Equal(t, "CREATE", spans[0].Name())
+	assert.Equal(t, "INSERT", spans[1].Name())
+
+	assert.Equal(t, "SELECT", spans[2].Name())
+	assert.Contains(t, spans[2].Attributes(), semconv.DBQueryText("SELECT id FROM posts WHERE id = ?"))
+	assert.Contains(t, spans[2].Attributes(), attribute.String("db.operation.name", "SELECT"))
+	assert.Equal(t, codes.Unset, spans[2].Status().Code)
+	for _, attr := range spans[2].Attributes() {
+		assert.NotEqual(t, "post-1", attr.Value.AsString(), "arguments must not be recorded")
+	}
+
+	assert.Equal(t, codes.Error, spans[3].Status().Code)
+
+	for _, span := range spans {
+		assert.Contains(t, span.Attributes(), semconv.DBSystemSqlite, "span %s", span.Name())
+	}
+	assert.Equal(t, semconv.DBSystemPostgreSQL, NewStoragePostgres(sqlDB).db.system)
+}
@@ -0,0 +1,499 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"ozontz/app/models"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	walFileName = "wal.log"
+	// previousWALFileName holds the records logged before a compaction
+	// started, until its snapshot is on disk.
+	previousWALFileName = "wal.log.1"
+	snapshotFileName    = "snapshot.json"
+)
+
+// FsyncPolicy tells the write-ahead log when appended records are flushed to
+// disk.
+type FsyncPolicy string
+
+const (
+	// FsyncAlways syncs after every record, so an acknowledged write survives
+	// a power loss.
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval syncs in the background, losing at most one interval of
+	// writes on a power loss.
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNever leaves flushing to the operating system.
+	FsyncNever FsyncPolicy = "never"
+)
+
+func ParseFsyncPolicy(policy string) (FsyncPolicy, error) {
+	switch p := FsyncPolicy(policy); p {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown fsync policy %q, expected 'always', 'interval' or 'never'", policy)
+	}
+}
+
+type WALConfig struct {
+	// Dir holds the log and the latest snapshot.
+	Dir           string        `yaml:"dir"`
+	Fsync         FsyncPolicy   `yaml:"fsync"`
+	FsyncInterval time.Duration `yaml:"fsync_interval"`
+	// CompactAfter is the number of records after which a snapshot is taken
+	// and the log truncated. Writers only wait while the state is copied and
+	// the log rotated; the snapshot is written in the background. Zero keeps
+	// the whole log.
+	CompactAfter int `yaml:"compact_after"`
+}
+
+// Operations of a walRecord. Records carry the resulting row rather than the
+// call that produced it, so replaying them needs no validation.
+const (
+	opPutPost       = "putPost"
+	opDeletePost    = "deletePost"
+	opPutComment    = "putComment"
+	opDeleteComment = "deleteComment"
+)
+
+type walRecord struct {
+	Seq     uint64          `json:"seq"`
+	Op      string          `json:"op"`
+	ID      string          `json:"id,omitempty"`
+	Post    *models.Post    `json:"post,omitempty"`
+	Comment *models.Comment `json:"comment,omitempty"`
+}
+
+type snapshot struct {
+	// Seq is the last record included, older records are skipped on replay.
+	Seq      uint64            `json:"seq"`
+	Posts    []*models.Post    `json:"posts"`
+	Comments []*models.Comment `json:"comments"`
+}
+
+type wal struct {
+	config WALConfig
+	// mu guards file against syncLoop while the log is rotated. Everything
+	// else is guarded by the mutex of the store.
+	mu   sync.Mutex
+	file *os.File
+	// size is where the last complete record of file ends. A failed append
+	// truncates the file back to it.
+	size int64
+	// failed is set once the log can't be restored after a failed append;
+	// writes are refused from then on.
+	failed error
+
+	seq           uint64
+	sinceSnapshot int
+
+	compacting  atomic.Bool
+	compactions sync.WaitGroup
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewStorageInMemoryWithWAL returns an in-memory store that logs every change
+// to cfg.Dir and restores the state found there.
+func NewStorageInMemoryWithWAL(cfg WALConfig) (*InMemoryStorage, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+
+	s := NewStorageInMemory()
+	w := &wal{config: cfg, stop: make(chan struct{})}
+
+	if err := s.loadSnapshot(w); err != nil {
+		return nil, err
+	}
+	if err := s.replay(w); err != nil {
+		return nil, err
+	}
+
+	if cfg.Fsync == FsyncInterval && cfg.FsyncInterval > 0 {
+		w.stopped.Add(1)
+		go w.syncLoop()
+	}
+
+	s.wal = w
+	return s, nil
+}
+
+// Close flushes the log and releases its file. It does nothing for a store
+// without a log.
+func (s *InMemoryStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	w := s.wal
+	s.wal = nil
+
+	close(w.stop)
+	w.stopped.Wait()
+	w.compactions.Wait()
+
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// persist appends rec to the log ahead of applying it. It must be called with
+// s.mu held.
+func (s *InMemoryStorage) persist(rec walRecord) error {
+	if s.wal == nil {
+		return nil
+	}
+	if err := s.wal.append(rec); err != nil {
+		return fmt.Errorf("failed to write WAL: %w", err)
+	}
+	return nil
+}
+
+// commit applies rec and compacts the log once it grew long enough. It must be
+// called with s.mu held, right after persist.
+func (s *InMemoryStorage) commit(rec walRecord) {
+	s.apply(rec)
+
+	w := s.wal
+	if w == nil || w.config.CompactAfter <= 0 || w.sinceSnapshot < w.config.CompactAfter || w.compacting.Load() {
+		return
+	}
+	// The record is already durable, so a failed compaction only delays it
+	// until the next write.
+	previous, err := w.rotate()
+	if err != nil {
+		slog.Error("Failed to compact WAL", "error", err)
+		return
+	}
+	w.sinceSnapshot = 0
+	w.compacting.Store(true)
+	w.compactions.Add(1)
+	go w.compact(s.snapshot(), previous)
+}
+
+func (s *InMemoryStorage) apply(rec walRecord) {
+	switch rec.Op {
+	case opPutPost:
+		s.putPost(rec.Post)
+	case opDeletePost:
+		s.removePost(rec.ID)
+	case opPutComment:
+		s.putComment(rec.Comment)
+	case opDeleteComment:
+		s.removeComment(rec.ID)
+	}
+}
+
+func (s *InMemoryStorage) loadSnapshot(w *wal) error {
+	data, err := os.ReadFile(filepath.Join(w.config.Dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	// Oldest first, so that building the indexes only appends.
+	sort.Slice(snap.Posts, func(i, j int) bool {
+		return postCursor(snap.Posts[i]).less(postCursor(snap.Posts[j]))
+	})
+	sortComments(snap.Comments)
+	for _, post := range snap.Posts {
+		s.putPost(post)
+	}
+	for _, comment := range snap.Comments {
+		s.putComment(comment)
+	}
+	w.seq = snap.Seq
+
+	return nil
+}
+
+// replay applies the records logged after the snapshot, including the ones
+// of a compaction that didn't finish, and leaves the log open for appending.
+func (s *InMemoryStorage) replay(w *wal) error {
+	previous, err := s.replayFile(w, filepath.Join(w.config.Dir, previousWALFileName), os.O_RDWR)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if previous != nil {
+		previous.Close()
+	}
+
+	w.file, err = s.replayFile(w, filepath.Join(w.config.Dir, walFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	info, err := w.file.Stat()
+	if err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to stat WAL: %w", err)
+	}
+	w.size = info.Size()
+	return nil
+}
+
+// replayFile applies the records of the log at path. A record cut short by a
+// crash is dropped.
+func (s *InMemoryStorage) replayFile(w *wal, path string, flag int) (*os.File, error) {
+	file, err := os.OpenFile(path, flag, 0o644)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				slog.Warn("Dropping incomplete WAL record", "file", path, "offset", offset)
+				if err := file.Truncate(offset); err != nil {
+					file.Close()
+					return nil, fmt.Errorf("failed to truncate WAL: %w", err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read WAL: %w", err)
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("corrupted WAL record in %s at offset %d: %w", path, offset, err)
+		}
+		offset += int64(len(line))
+
+		if rec.Seq <= w.seq {
+			// Already part of the snapshot: the process stopped between
+			// writing it and truncating the log.
+			continue
+		}
+		s.apply(rec)
+		w.seq = rec.Seq
+		w.sinceSnapshot++
+	}
+
+	return file, nil
+}
+
+// snapshot copies the current state. Stored rows are never modified in
+// place, so the copy can be encoded without holding s.mu. It must be called
+// with s.mu held.
+func (s *InMemoryStorage) snapshot() snapshot {
+	snap := snapshot{
+		Seq:      s.wal.seq,
+		Posts:    make([]*models.Post, 0, len(s.posts)),
+		Comments: make([]*models.Comment, 0, len(s.comments)),
+	}
+	for _, post := range s.posts {
+		snap.Posts = append(snap.Posts, post)
+	}
+	for _, comment := range s.comments {
+		snap.Comments = append(snap.Comments, comment)
+	}
+	return snap
+}
+
+// rotate moves the log aside and starts a new one, so that the records
+// covered by the next snapshot can be dropped while writers append to the new
+// log. It returns the old log, or nil if the log of a failed compaction is
+// still aside: that one is dropped along with the next snapshot instead. It
+// must be called with the mutex of the store held.
+func (w *wal) rotate() (*os.File, error) {
+	path := filepath.Join(w.config.Dir, walFileName)
+	previousPath := filepath.Join(w.config.Dir, previousWALFileName)
+
+	if _, err := os.Stat(previousPath); err == nil {
+		return nil, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := os.Rename(path, previousPath); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		if renameErr := os.Rename(previousPath, path); renameErr != nil {
+			return nil, errors.Join(err, renameErr)
+		}
+		return nil, err
+	}
+
+	w.mu.Lock()
+	previous := w.file
+	w.file = file
+	w.mu.Unlock()
+	w.size = 0
+	return previous, nil
+}
+
+// compact writes snap and then removes the log it covers.
+func (w *wal) compact(snap snapshot, previous *os.File) {
+	defer w.compactions.Done()
+	defer w.compacting.Store(false)
+
+	if previous != nil {
+		// Its records are only safe once the snapshot is on disk.
+		err := previous.Sync()
+		if closeErr := previous.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			slog.Error("Failed to compact WAL", "error", err)
+			return
+		}
+	}
+
+	if err := writeSnapshot(w.config.Dir, snap); err != nil {
+		slog.Error("Failed to compact WAL", "error", err)
+		return
+	}
+	if err := os.Remove(filepath.Join(w.config.Dir, previousWALFileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("Failed to remove compacted WAL", "error", err)
+		return
+	}
+	if err := syncDir(w.config.Dir); err != nil {
+		slog.Error("Failed to compact WAL", "error", err)
+	}
+}
+
+// writeSnapshot stores snap in dir, replacing the previous snapshot
+// atomically.
+func writeSnapshot(dir string, snap snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, snapshotFileName)
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// writeRecord writes a record to the log. Tests replace it to simulate short
+// writes.
+var writeRecord = func(file *os.File, data []byte) (int, error) {
+	return file.Write(data)
+}
+
+func (w *wal) append(rec walRecord) error {
+	if w.failed != nil {
+		return w.failed
+	}
+	rec.Seq = w.seq + 1
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := writeRecord(w.file, data); err != nil {
+		return w.discard(err)
+	}
+	if w.config.Fsync == FsyncAlways {
+		if err := w.file.Sync(); err != nil {
+			return w.discard(err)
+		}
+	}
+
+	w.size += int64(len(data))
+	w.seq = rec.Seq
+	w.sinceSnapshot++
+	return nil
+}
+
+// discard drops whatever part of a failed record reached the log, so that the
+// next record doesn't follow a torn one. If that fails too the log is marked
+// failed, as replaying it would stop at the torn record.
+func (w *wal) discard(err error) error {
+	if truncateErr := w.file.Truncate(w.size); truncateErr != nil {
+		w.failed = fmt.Errorf("WAL is unusable after a failed write: %w", errors.Join(err, truncateErr))
+		slog.Error("Failed to discard partial WAL record", "error", w.failed)
+		return w.failed
+	}
+	return err
+}
+
+func (w *wal) syncLoop() {
+	defer w.stopped.Done()
+
+	ticker := time.NewTicker(w.config.FsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			err := w.file.Sync()
+			w.mu.Unlock()
+			if err != nil {
+				slog.Error("Failed to sync WAL", "error", err)
+			}
+		}
+	}
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ozontz/app/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openWALStore(t *testing.T, cfg WALConfig) *InMemoryStorage {
+	store, err := NewStorageInMemoryWithWAL(cfg)
+	require.NoError(t, err)
+	return store
+}
+
+func TestWALReplaysChanges(t *testing.T) {
+	ctx := context.Background()
+	cfg := WALConfig{Dir: t.TempDir(), Fsync: FsyncAlways}
+
+	store := openWALStore(t, cfg)
+	post, err := store.CreatePost(ctx, &models.Post{Title: "Title", Content: "Content", AuthorID: "user-1", AllowComments: true})
+	require.NoError(t, err)
+	removed, err := store.CreatePost(ctx, &models.Post{Title: "Removed", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+	require.NoError(t, store.DeletePost(ctx, removed.ID))
+
+	parent, err := store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Parent"})
+	require.NoError(t, err)
+	_, err = store.AddComment(ctx, &models.Comment{PostID: post.ID, ParentID: &parent.ID, AuthorID: "user-3", Text: "Reply"})
+	require.NoError(t, err)
+	leaf, err := store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Leaf"})
+	require.NoError(t, err)
+
+	title := "Edited"
+	_, err = store.UpdatePost(ctx, post.ID, &title, nil)
+	require.NoError(t, err)
+	_, err = store.SetCommentsAllowed(ctx, post.ID, false)
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteComment(ctx, parent.ID))
+	require.NoError(t, store.DeleteComment(ctx, leaf.ID))
+	require.NoError(t, store.Close())
+
+	store = openWALStore(t, cfg)
+	defer store.Close()
+
+	restored, err := store.GetPostByID(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Edited", restored.Title)
+	assert.False(t, restored.AllowComments)
+	assert.NotNil(t, restored.UpdatedAt)
+
+	_, err = store.GetPostByID(ctx, removed.ID)
+	assert.ErrorIs(t, err, ErrPostNotFound)
+
+	tombstone, err := store.GetCommentByID(ctx, parent.ID)
+	require.NoError(t, err)
+	assert.True(t, tombstone.Deleted)
+	_, err = store.GetCommentByID(ctx, leaf.ID)
+	assert.ErrorIs(t, err, ErrCommentNotFound)
+}
+
+func TestWALCompaction(t *testing.T) {
+	ctx := context.Background()
+	cfg := WALConfig{Dir: t.TempDir(), Fsync: FsyncNever, CompactAfter: 3}
+
+	store := openWALStore(t, cfg)
+	post, err := store.CreatePost(ctx, &models.Post{Title: "Title", Content: "Content", AuthorID: "user-1", AllowComments: true})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := store.AddComment(ctx, &models.Comment{PostID: post.ID, AuthorID: "user-2", Text: "Comment"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.Close())
+
+	_, err = os.Stat(filepath.Join(cfg.Dir, snapshotFileName))
+	require.NoError(t, err, "a snapshot should have been written")
+	info, err := os.Stat(filepath.Join(cfg.Dir, walFileName))
+	require.NoError(t, err)
+	assert.NotZero(t, info.Size(), "the record after the snapshot should stay in the log")
+	_, err = os.Stat(filepath.Join(cfg.Dir, previousWALFileName))
+	assert.ErrorIs(t, err, os.ErrNotExist, "the compacted log should be removed")
+
+	store = openWALStore(t, cfg)
+	defer store.Close()
+
+	comments, err := store.GetComments(ctx, post.ID, PageArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, comments.TotalCount)
+}
+
+func TestWALSkipsRecordsInSnapshot(t *testing.T) {
+	ctx := context.Background()
+	cfg := WALConfig{Dir: t.TempDir(), Fsync: FsyncNever}
+
+	store := openWALStore(t, cfg)
+	post, err := store.CreatePost(ctx, &models.Post{Title: "Title", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+	log, err := os.ReadFile(filepath.Join(cfg.Dir, walFileName))
+	require.NoError(t, err)
+
+	// Simulate a crash after the snapshot was renamed into place but before
+	// the log was truncated.
+	store.mu.Lock()
+	snap := store.snapshot()
+	store.mu.Unlock()
+	require.NoError(t, writeSnapshot(cfg.Dir, snap))
+	require.NoError(t, store.DeletePost(ctx, post.ID))
+	require.NoError(t, store.Close())
+	deleteRecord, err := os.ReadFile(filepath.Join(cfg.Dir, walFileName))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Dir, walFileName), append(log, deleteRecord...), 0o644))
+
+	store = openWALStore(t, cfg)
+	defer store.Close()
+
+	_, err = store.GetPostByID(ctx, post.ID)
+	assert.ErrorIs(t, err, ErrPostNotFound)
+}
+
+func TestWALReplaysUnfinishedCompaction(t *testing.T) {
+	ctx := context.Background()
+	cfg := WALConfig{Dir: t.TempDir(), Fsync: FsyncNever, CompactAfter: 3}
+
+	store := openWALStore(t, cfg)
+	first, err := store.CreatePost(ctx, &models.Post{Title: "First", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// Simulate a crash after the log was rotated but before the snapshot
+	// was written.
+	require.NoError(t, os.Rename(filepath.Join(cfg.Dir, walFileName), filepath.Join(cfg.Dir, previousWALFileName)))
+
+	store = openWALStore(t, cfg)
+	second, err := store.CreatePost(ctx, &models.Post{Title: "Second", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+	_, err = store.CreatePost(ctx, &models.Post{Title: "Third", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	_, err = os.Stat(filepath.Join(cfg.Dir, previousWALFileName))
+	assert.ErrorIs(t, err, os.ErrNotExist, "the next compaction should drop the old log")
+
+	store = openWALStore(t, cfg)
+	defer store.Close()
+	for _, post := range []*models.Post{first, second} {
+		_, err := store.GetPostByID(ctx, post.ID)
+		assert.NoError(t, err)
+	}
+}
+
+func TestWALDropsTornRecord(t *testing.T) {
+	ctx := context.Background()
+	cfg := WALConfig{Dir: t.TempDir(), Fsync: FsyncAlways}
+
+	store := openWALStore(t, cfg)
+	post, err := store.CreatePost(ctx, &models.Post{Title: "Title", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	file, err := os.OpenFile(filepath.Join(cfg.Dir, walFileName), os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"seq":2,"op":"putPo`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	store = openWALStore(t, cfg)
+	_, err = store.GetPostByID(ctx, post.ID)
+	assert.NoError(t, err)
+
+	// New records must not be appended after the torn one.
+	_, err = store.CreatePost(ctx, &models.Post{Title: "Next", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store = openWALStore(t, cfg)
+	defer store.Close()
+	posts, err := store.GetPosts(ctx, PageArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, posts.TotalCount)
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	policy, err := ParseFsyncPolicy("interval")
+	require.NoError(t, err)
+	assert.Equal(t, FsyncInterval, policy)
+
+	_, err = ParseFsyncPolicy("sometimes")
+	assert.Error(t, err)
+}
+
+func TestWALRecoversFromShortWrite(t *testing.T) {
+	ctx := context.Background()
+	cfg := WALConfig{Dir: t.TempDir(), Fsync: FsyncAlways}
+
+	store := openWALStore(t, cfg)
+	first, err := store.CreatePost(ctx, &models.Post{Title: "First", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+
+	defer func(write func(*os.File, []byte) (int, error)) { writeRecord = write }(writeRecord)
+	writeRecord = func(file *os.File, data []byte) (int, error) {
+		n, _ := file.Write(data[:len(data)/2])
+		return n, errors.New("no space left on device")
+	}
+	_, err = store.CreatePost(ctx, &models.Post{Title: "Lost", Content: "Content", AuthorID: "user-1"})
+	require.Error(t, err)
+
+	writeRecord = func(file *os.File, data []byte) (int, error) { return file.Write(data) }
+	second, err := store.CreatePost(ctx, &models.Post{Title: "Second", Content: "Content", AuthorID: "user-1"})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store = openWALStore(t, cfg)
+	defer store.Close()
+	posts, err := store.GetPosts(ctx, PageArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, posts.TotalCount)
+	for _, post := range []*models.Post{first, second} {
+		_, err := store.GetPostByID(ctx, post.ID)
+		assert.NoError(t, err)
+	}
+}
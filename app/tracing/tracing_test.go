@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetupFileExporter(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "traces.json")
+
+	shutdown, err := Setup(ctx, Config{Exporter: ExporterFile, File: path, SampleRatio: 1, ServiceName: "ozontz-test"})
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(ctx, "test-span")
+	span.End()
+	require.NoError(t, shutdown(ctx))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"test-span"`)
+	assert.Contains(t, string(data), "ozontz-test")
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "zipkin"})
+	assert.ErrorContains(t, err, "unknown trace exporter")
+
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"ozontz/app/auth"
+	"ozontz/app/config"
+)
+
+const configUsage = `Usage: %s config validate [-config <file>] [flags]
+
+  validate  loads the configuration the server would start with, from the
+            file, env variables and flags, and reports every invalid setting
+`
+
+// runConfig implements the config subcommand.
+func runConfig(name string, args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return fmt.Errorf(configUsage, name)
+	}
+
+	cfg, err := config.Load("config validate", args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	errs := []error{cfg.Validate()}
+	if _, err := auth.LoadConfig(cfg.Auth.JWTSecretFile, cfg.Auth.JWTPublicKeyFile, cfg.Auth.Dev); err != nil {
+		errs = append(errs, fmt.Errorf("auth: %w", err))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	log.Println("Configuration is valid")
+	return nil
+}
@@ -2,68 +2,216 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"flag"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"ozontz/app/auth"
+	"ozontz/app/config"
 	"ozontz/app/graph"
+	"ozontz/app/health"
+	"ozontz/app/logging"
+	"ozontz/app/metrics"
+	"ozontz/app/persisted"
 	"ozontz/app/storage"
+	"ozontz/app/tracing"
 	"syscall"
 	"time"
 
-	"github.com/graphql-go/graphql"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func main() {
-	storageType := flag.String(
-		"storage",
-		"inmemory",
-		"Select storage type: 'inmemory' or 'postgres'. 'inmemory' by default",
-	)
-	flag.Parse()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "persisted-queries":
+			if err := runPersistedQueries(os.Args[0], os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "config":
+			if err := runConfig(os.Args[0], os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	cfg, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Logging)
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	authConfig, err := auth.LoadConfig(cfg.Auth.JWTSecretFile, cfg.Auth.JWTPublicKeyFile, cfg.Auth.Dev)
+	if err != nil {
+		fatal("Failed to configure authentication", "error", err)
+	}
+	if authConfig.DevMode {
+		slog.Warn("Authentication dev mode is enabled, X-Viewer-Id is trusted")
+	}
+
+	idGenerator, err := storage.NewIDGenerator(cfg.Storage.IDFormat)
+	if err != nil {
+		fatal("Invalid ID format", "error", err)
+	}
+	storage.SetIDGenerator(idGenerator)
+	storage.SetLimits(cfg.Limits)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		fatal("Failed to configure tracing", "error", err)
+	}
 
 	var store storage.Storage
-	switch *storageType {
+	var db *sql.DB
+	switch cfg.Storage.Type {
 	case "inmemory":
-		log.Println("Initializing in-memory store...")
-		store = storage.NewStorageInMemory()
+		slog.Info("Initializing in-memory store")
+		if cfg.Storage.WAL.Dir == "" {
+			store = storage.NewStorageInMemory()
+			break
+		}
+		memStore, err := storage.NewStorageInMemoryWithWAL(cfg.Storage.WAL)
+		if err != nil {
+			fatal("Failed to restore in-memory store", "error", err)
+		}
+		defer memStore.Close()
+		store = memStore
+		slog.Info("Write-ahead log enabled", "dir", cfg.Storage.WAL.Dir)
 	case "postgres":
-		log.Println("Initializing postgres store...")
-		db, err := storage.InitPostgresDB()
+		slog.Info("Initializing postgres store")
+		dsn, err := cfg.Database.ConnString()
+		if err != nil {
+			fatal("Failed to configure database", "error", err)
+		}
+		db, err = storage.InitPostgresDB(cfg.Database)
+		if err != nil {
+			fatal("Failed to connect to database", "error", err)
+		}
+		pgStore := storage.NewStoragePostgres(db)
+		store = pgStore
+		slog.Info("Connected to database")
+
+		broker := storage.NewPostgresBroker(dsn, pgStore)
+		go func() {
+			if err := broker.Listen(ctx); err != nil {
+				slog.Error("Comment listener stopped", "error", err)
+			}
+		}()
+		graph.SetBroker(broker)
+	case "sqlite":
+		slog.Info("Initializing sqlite store", "path", cfg.Storage.SQLitePath)
+		sqliteDB, err := storage.InitSQLiteDB(cfg.Storage.SQLitePath)
 		if err != nil {
-			log.Fatalf("Failed to connect to database: %v", err)
+			fatal("Failed to open database", "error", err)
 		}
-		store = storage.NewStoragePostgres(db)
-		log.Println("Connectet to db")
+		defer sqliteDB.Close()
+		store = storage.NewStorageSQLite(sqliteDB)
 	default:
-		log.Fatalf("Invalid storage type: %s", *storageType)
+		fatal("Invalid storage type", "storage", cfg.Storage.Type)
 	}
 
-	graph.SetStore(store)
+	graph.SetStore(metrics.NewInstrumentedStorage(store))
+	graph.SetQueryLimits(cfg.Query)
+	graph.SetBatchConfig(cfg.Batch)
+
+	if cfg.PersistedQueries.Mode != "off" {
+		allowList := cfg.PersistedQueries.Mode == "allowlist"
+
+		size := cfg.PersistedQueries.CacheSize
+		if allowList {
+			// Approved queries must never be evicted.
+			size = 0
+		}
+
+		var queryStore persisted.Store
+		switch cfg.PersistedQueries.Store {
+		case "memory":
+			queryStore = persisted.NewLRU(size)
+		case "postgres":
+			if db == nil {
+				fatal("The 'postgres' persisted query store requires -storage=postgres")
+			}
+			queryStore = persisted.NewPostgresStore(db, size)
+		default:
+			fatal("Invalid persisted query store", "store", cfg.PersistedQueries.Store)
+		}
 
-	schema, err := graphql.NewSchema(graphql.SchemaConfig{
-		Query:    graph.QueryType,
-		Mutation: graph.MutationType,
-	})
+		if cfg.PersistedQueries.Manifest != "" {
+			manifest, err := persisted.ReadManifest(cfg.PersistedQueries.Manifest)
+			if err != nil {
+				fatal("Failed to read persisted query manifest", "error", err)
+			}
+			if err := persisted.Preload(ctx, queryStore, manifest); err != nil {
+				fatal("Failed to preload persisted queries", "error", err)
+			}
+			slog.Info("Preloaded persisted queries", "count", len(manifest.Operations))
+		}
+
+		graph.SetPersistedQueries(queryStore, allowList)
+	}
+
+	schema, err := newSchema()
 	if err != nil {
-		log.Fatalf("Failed to create schema: %v", err)
+		fatal("Failed to create schema", "error", err)
 	}
+	schema.AddExtensions(metrics.GraphQLExtension{})
+
+	queryHandler := auth.Middleware(authConfig, graph.RequestTimeout(cfg.Server.RequestTimeout, graph.GraphQLHandler(&schema)))
+	http.Handle("/query", otelhttp.NewHandler(queryHandler, "/query"))
+	http.Handle("/metrics", metrics.Handler())
+	checker := health.NewChecker(store.HealthCheck, health.DefaultTimeout)
+	http.Handle("/healthz", checker.Liveness())
+	http.Handle("/readyz", checker.Readiness())
+	http.Handle("/subscriptions", auth.Middleware(authConfig, graph.SubscriptionHandler(&schema)))
 
-	http.Handle("/query", graph.GraphQLHandler(&schema))
+	slog.Info("Initializing server")
 
-	log.Println("Initializing server...")
+	// Requests outlive the app context so in-flight ones can finish during a
+	// graceful shutdown; whatever is still running after it is cancelled.
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: nil,
+		Addr:              cfg.Server.Addr,
+		Handler:           logging.Middleware(http.DefaultServeMux),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
 	}
 
 	go func() {
-		log.Println("Starting server on :8080")
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("Could not start server: %v", err)
+		slog.Info("Starting server", "addr", server.Addr, "tls", cfg.Server.TLSCertFile != "")
+		var err error
+		if cfg.Server.TLSCertFile != "" {
+			err = server.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			fatal("Could not start server", "error", err)
 		}
 	}()
 
@@ -71,12 +219,28 @@ func main() {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 	<-shutdown
 
-	log.Println("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	slog.Info("Shutting down server")
+	// Fail readiness first, so that load balancers stop routing new requests
+	// here before the listener closes.
+	checker.Shutdown()
+	time.Sleep(cfg.Server.ShutdownDelay)
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer shutdownCancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Error during shutdown: %v", err)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error during shutdown", "error", err)
+	}
+	cancelRequests()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
 	}
-	log.Println("Server stopped")
+	slog.Info("Server stopped")
+}
+
+// fatal logs an error that keeps the server from starting and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
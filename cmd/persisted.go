@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"ozontz/app/config"
+	"ozontz/app/graph"
+	"ozontz/app/persisted"
+	"ozontz/app/storage"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+const persistedQueriesUsage = `Usage: %s persisted-queries <check|load> -manifest <file> [-config <file>]
+
+  check  validates every operation of the manifest against the schema
+  load   checks the manifest and stores its operations in PostgreSQL,
+         the database is configured like for the server: by the config
+         file and the OZONTZ_DB_* or DB_* env variables
+`
+
+// runPersistedQueries implements the persisted-queries subcommand.
+func runPersistedQueries(name string, args []string) error {
+	if len(args) == 0 || (args[0] != "check" && args[0] != "load") {
+		return fmt.Errorf(persistedQueriesUsage, name)
+	}
+	command := args[0]
+
+	flags := flag.NewFlagSet("persisted-queries "+command, flag.ExitOnError)
+	manifestPath := flags.String("manifest", "", "Path to an Apollo persisted query manifest")
+	configPath := flags.String("config", "", "YAML configuration file of the server. Falls back to the "+config.FileEnv+" env variable")
+	flags.Parse(args[1:])
+	if *manifestPath == "" {
+		return fmt.Errorf("-manifest is required")
+	}
+
+	manifest, err := persisted.ReadManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	if err := checkManifest(manifest); err != nil {
+		return err
+	}
+	if command == "check" {
+		log.Printf("Manifest is valid, %d operations", len(manifest.Operations))
+		return nil
+	}
+
+	var configArgs []string
+	if *configPath != "" {
+		configArgs = []string{"-config", *configPath}
+	}
+	cfg, err := config.Load("persisted-queries load", configArgs)
+	if err != nil {
+		return err
+	}
+	db, err := storage.InitPostgresDB(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if err := persisted.Preload(context.Background(), persisted.NewPostgresStore(db, 0), manifest); err != nil {
+		return err
+	}
+	log.Printf("Loaded %d operations", len(manifest.Operations))
+	return nil
+}
+
+// checkManifest validates the operations of a manifest against the schema,
+// so that an approved operation can't fail on every request.
+func checkManifest(manifest *persisted.Manifest) error {
+	schema, err := newSchema()
+	if err != nil {
+		return err
+	}
+
+	for _, op := range manifest.Operations {
+		doc, err := parser.Parse(parser.ParseParams{Source: op.Body})
+		if err != nil {
+			return fmt.Errorf("operation %s: %w", op.Name, err)
+		}
+		if result := graphql.ValidateDocument(&schema, doc, nil); !result.IsValid {
+			return fmt.Errorf("operation %s: %s", op.Name, result.Errors[0].Message)
+		}
+	}
+	return nil
+}
+
+func newSchema() (graphql.Schema, error) {
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        graph.QueryType,
+		Mutation:     graph.MutationType,
+		Subscription: graph.SubscriptionType,
+	})
+}
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS comments_notify_added ON comments;
+DROP FUNCTION IF EXISTS notify_comment_added();
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE OR REPLACE FUNCTION notify_comment_added() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify(
+        'comment_added',
+        json_build_object('id', NEW.id, 'post_id', NEW.post_id, 'created_at', NEW.created_at)::text
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comments_notify_added
+    AFTER INSERT ON comments
+    FOR EACH ROW EXECUTE FUNCTION notify_comment_added();
@@ -0,0 +1 @@
+CREATE INDEX idx_comments_parent_id_created_at ON comments(parent_id, created_at);
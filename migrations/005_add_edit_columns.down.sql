@@ -0,0 +1,4 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted;
+ALTER TABLE comments DROP COLUMN IF EXISTS updated_at;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS updated_at;
\ No newline at end of file
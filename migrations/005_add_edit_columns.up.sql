@@ -0,0 +1,4 @@
+ALTER TABLE posts ADD COLUMN updated_at TIMESTAMP;
+
+ALTER TABLE comments ADD COLUMN updated_at TIMESTAMP;
+ALTER TABLE comments ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE;
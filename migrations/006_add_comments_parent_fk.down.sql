@@ -0,0 +1,3 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS depth;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_parent_id_fkey;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_post_id_id_key;
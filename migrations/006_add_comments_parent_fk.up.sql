@@ -0,0 +1,32 @@
+-- Replies that point at a missing comment or at a comment of another post
+-- could never satisfy the constraint below, so they become top-level comments.
+UPDATE comments c
+SET parent_id = NULL
+WHERE parent_id IS NOT NULL
+  AND NOT EXISTS (
+      SELECT 1 FROM comments p WHERE p.id = c.parent_id AND p.post_id = c.post_id
+  );
+
+ALTER TABLE comments ADD CONSTRAINT comments_post_id_id_key UNIQUE (post_id, id);
+
+-- Referencing (post_id, id) rather than id alone keeps a reply in the same
+-- post as its parent.
+ALTER TABLE comments
+    ADD CONSTRAINT comments_parent_id_fkey
+    FOREIGN KEY (post_id, parent_id) REFERENCES comments (post_id, id);
+
+ALTER TABLE comments ADD COLUMN depth SMALLINT NOT NULL DEFAULT 1;
+
+WITH RECURSIVE tree AS (
+    SELECT id, 1 AS depth
+    FROM comments
+    WHERE parent_id IS NULL
+    UNION ALL
+    SELECT c.id, t.depth + 1
+    FROM comments c
+    JOIN tree t ON c.parent_id = t.id
+)
+UPDATE comments c
+SET depth = tree.depth
+FROM tree
+WHERE c.id = tree.id;
@@ -0,0 +1,9 @@
+ALTER TABLE comments
+    ALTER COLUMN id TYPE VARCHAR(36),
+    ALTER COLUMN post_id TYPE VARCHAR(36),
+    ALTER COLUMN parent_id TYPE VARCHAR(36),
+    ALTER COLUMN author_id TYPE VARCHAR(36);
+
+ALTER TABLE posts
+    ALTER COLUMN id TYPE VARCHAR(36),
+    ALTER COLUMN author_id TYPE VARCHAR(36);
@@ -0,0 +1,11 @@
+-- Generated IDs are a prefix followed by a ULID or a UUID, which no longer
+-- fits into 36 characters. Widening a VARCHAR does not rewrite the table.
+ALTER TABLE posts
+    ALTER COLUMN id TYPE VARCHAR(64),
+    ALTER COLUMN author_id TYPE VARCHAR(64);
+
+ALTER TABLE comments
+    ALTER COLUMN id TYPE VARCHAR(64),
+    ALTER COLUMN post_id TYPE VARCHAR(64),
+    ALTER COLUMN parent_id TYPE VARCHAR(64),
+    ALTER COLUMN author_id TYPE VARCHAR(64);
@@ -0,0 +1,6 @@
+-- Documents of persisted queries, keyed by the hex SHA-256 of their text.
+CREATE TABLE persisted_queries (
+    hash VARCHAR(64) PRIMARY KEY,
+    query TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
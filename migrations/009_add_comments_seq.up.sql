@@ -0,0 +1,16 @@
+-- seq numbers comments in insertion order from one database sequence, so that
+-- listeners can resume after the last comment they saw whatever the clocks of
+-- the instances writing comments say.
+ALTER TABLE comments ADD COLUMN seq BIGSERIAL NOT NULL;
+CREATE INDEX idx_comments_post_id_seq ON comments(post_id, seq);
+CREATE INDEX idx_comments_seq ON comments(seq);
+
+CREATE OR REPLACE FUNCTION notify_comment_added() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify(
+        'comment_added',
+        json_build_object('id', NEW.id, 'post_id', NEW.post_id, 'seq', NEW.seq)::text
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,19 @@
+-- Referencing (post_id, id) rather than id alone keeps a reply in the same
+-- post as its parent.
+CREATE TABLE comments (
+    id VARCHAR(36) PRIMARY KEY,
+    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    parent_id VARCHAR(36),
+    author_id VARCHAR(36) NOT NULL,
+    text TEXT NOT NULL,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    depth SMALLINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP,
+    CONSTRAINT comments_post_id_id_key UNIQUE (post_id, id),
+    CONSTRAINT comments_parent_id_fkey
+        FOREIGN KEY (post_id, parent_id) REFERENCES comments (post_id, id)
+);
+
+CREATE INDEX idx_comments_post_id_created_at ON comments(post_id, created_at, id);
+CREATE INDEX idx_comments_parent_id_created_at ON comments(parent_id, created_at, id);